@@ -0,0 +1,37 @@
+package apikey
+
+import "time"
+
+// ScopeCampaignsWrite is the only scope so far, campaigns are read
+// without any key. A scope is only added together with the routes that
+// enforce it.
+const ScopeCampaignsWrite = "campaigns:write"
+
+var Scopes = []string{
+	ScopeCampaignsWrite,
+}
+
+// APIKey never holds the secret itself, only its SHA-256 hash. Prefix is
+// the non-secret part of the key used to recognise it in listings.
+type APIKey struct {
+	ID         int
+	UserID     int
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	LastUsedAt *time.Time
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,54 @@
+package apikey
+
+import "time"
+
+type APIKeyFormatter struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func FormatAPIKey(apiKey APIKey) APIKeyFormatter {
+	formatter := APIKeyFormatter{}
+	formatter.ID = apiKey.ID
+	formatter.Name = apiKey.Name
+	formatter.Prefix = apiKey.Prefix
+	formatter.Scopes = apiKey.Scopes
+	formatter.LastUsedAt = apiKey.LastUsedAt
+	formatter.ExpiresAt = apiKey.ExpiresAt
+	formatter.RevokedAt = apiKey.RevokedAt
+	formatter.CreatedAt = apiKey.CreatedAt
+
+	return formatter
+}
+
+func FormatAPIKeys(apiKeys []APIKey) []APIKeyFormatter {
+	formatters := []APIKeyFormatter{}
+
+	for _, apiKey := range apiKeys {
+		formatter := FormatAPIKey(apiKey)
+		formatters = append(formatters, formatter)
+	}
+
+	return formatters
+}
+
+// CreatedAPIKeyFormatter is only used right after creation, the one time
+// the plain key is available.
+type CreatedAPIKeyFormatter struct {
+	APIKeyFormatter
+	Key string `json:"key"`
+}
+
+func FormatCreatedAPIKey(apiKey APIKey, plainKey string) CreatedAPIKeyFormatter {
+	formatter := CreatedAPIKeyFormatter{}
+	formatter.APIKeyFormatter = FormatAPIKey(apiKey)
+	formatter.Key = plainKey
+
+	return formatter
+}
@@ -0,0 +1,15 @@
+package apikey
+
+import "chi-app/app/user"
+
+type CreateAPIKeyInput struct {
+	Name          string    `json:"name" validate:"required,max=100"`
+	Scopes        []string  `json:"scopes" validate:"required,min=1,dive,oneof=campaigns:write"`
+	ExpiresInDays int       `json:"expires_in_days" validate:"min=0,max=365"`
+	User          user.User `json:"-"`
+}
+
+type RevokeAPIKeyInput struct {
+	ID   int `uri:"id" validate:"required"`
+	User user.User
+}
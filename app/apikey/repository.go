@@ -0,0 +1,189 @@
+package apikey
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/app/tracing"
+	"chi-app/database"
+	"context"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type Repository interface {
+	Save(ctx context.Context, apiKey APIKey) (APIKey, error)
+	FindByID(ctx context.Context, ID int) (APIKey, error)
+	FindByHash(ctx context.Context, keyHash string) (APIKey, error)
+	FindByUserID(ctx context.Context, userID int) ([]APIKey, error)
+	Revoke(ctx context.Context, ID int) error
+	TouchLastUsed(ctx context.Context, ID int, usedAt time.Time) error
+}
+
+type repository struct {
+	DB *database.DB
+}
+
+func NewAPIKeyRepository(DB *database.DB) Repository {
+	return &repository{DB}
+}
+
+var apiKeyColumns = []string{
+	"id",
+	"user_id",
+	"name",
+	"prefix",
+	"key_hash",
+	"scopes",
+	"last_used_at",
+	"expires_at",
+	"revoked_at",
+	"created_at",
+}
+
+func (r *repository) Save(ctx context.Context, apiKey APIKey) (APIKey, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Repository.Save")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Insert("api_keys").
+		Columns(
+			"user_id",
+			"name",
+			"prefix",
+			"key_hash",
+			"scopes",
+			"expires_at",
+			"created_at").
+		Values(
+			apiKey.UserID,
+			apiKey.Name,
+			apiKey.Prefix,
+			apiKey.KeyHash,
+			strings.Join(apiKey.Scopes, ","),
+			apiKey.ExpiresAt,
+			time.Now().UTC())
+
+	apiKeyID, err := r.DB.InsertReturningID(ctx, sqlQuery)
+	if err != nil {
+		return apiKey, err
+	}
+
+	newAPIKey, err := r.FindByID(ctx, int(apiKeyID))
+	if err != nil {
+		return newAPIKey, err
+	}
+
+	return newAPIKey, nil
+}
+
+func (r *repository) FindByID(ctx context.Context, ID int) (APIKey, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Repository.FindByID")
+	defer span.End()
+
+	apiKeys, err := r.find(ctx, sq.Eq{"id": ID})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	if len(apiKeys) == 0 {
+		return APIKey{}, apperror.NotFound("api key not found")
+	}
+
+	return apiKeys[0], nil
+}
+
+func (r *repository) FindByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Repository.FindByHash")
+	defer span.End()
+
+	apiKeys, err := r.find(ctx, sq.Eq{"key_hash": keyHash})
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	if len(apiKeys) == 0 {
+		return APIKey{}, apperror.NotFound("api key not found")
+	}
+
+	return apiKeys[0], nil
+}
+
+func (r *repository) FindByUserID(ctx context.Context, userID int) ([]APIKey, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Repository.FindByUserID")
+	defer span.End()
+
+	return r.find(ctx, sq.Eq{"user_id": userID})
+}
+
+func (r *repository) find(ctx context.Context, where sq.Eq) ([]APIKey, error) {
+	apiKeys := []APIKey{}
+
+	sqlQuery := r.DB.Builder().Select(apiKeyColumns...).
+		From("api_keys").
+		Where(where).
+		OrderBy("id")
+
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
+	if err != nil {
+		return apiKeys, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var scopes string
+		apiKey := APIKey{}
+
+		err := rows.Scan(
+			&apiKey.ID,
+			&apiKey.UserID,
+			&apiKey.Name,
+			&apiKey.Prefix,
+			&apiKey.KeyHash,
+			&scopes,
+			&apiKey.LastUsedAt,
+			&apiKey.ExpiresAt,
+			&apiKey.RevokedAt,
+			&apiKey.CreatedAt,
+		)
+
+		if err != nil {
+			return apiKeys, err
+		}
+
+		apiKey.Scopes = []string{}
+		if scopes != "" {
+			apiKey.Scopes = strings.Split(scopes, ",")
+		}
+
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, rows.Err()
+}
+
+func (r *repository) Revoke(ctx context.Context, ID int) error {
+	ctx, span := tracing.Start(ctx, "apikey.Repository.Revoke")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Update("api_keys").
+		Set("revoked_at", time.Now().UTC()).
+		Where(sq.Eq{"id": ID, "revoked_at": nil}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlQuery.ExecContext(ctx)
+	return err
+}
+
+func (r *repository) TouchLastUsed(ctx context.Context, ID int, usedAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "apikey.Repository.TouchLastUsed")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Update("api_keys").
+		Set("last_used_at", usedAt.UTC()).
+		Where(sq.Eq{"id": ID}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlQuery.ExecContext(ctx)
+	return err
+}
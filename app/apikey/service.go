@@ -0,0 +1,171 @@
+package apikey
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/app/tracing"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// keys look like ck_<prefix>_<secret>; only the prefix is kept in clear
+const (
+	keyPrefix        = "ck"
+	prefixByteLength = 4
+	secretByteLength = 24
+)
+
+// Authenticate answers these for keys that do not check out. Any other
+// error means the key could not be checked at all.
+var (
+	ErrInvalidKey = errors.New("invalid api key")
+	ErrExpiredKey = errors.New("api key has expired")
+)
+
+type Service interface {
+	CreateAPIKey(ctx context.Context, input CreateAPIKeyInput) (APIKey, string, error)
+	GetAPIKeys(ctx context.Context, userID int) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, input RevokeAPIKeyInput) (APIKey, error)
+	Authenticate(ctx context.Context, plainKey string) (APIKey, error)
+}
+
+type service struct {
+	apiKeyRepository Repository
+}
+
+func NewAPIKeyService(apiKeyRepository Repository) Service {
+	return &service{apiKeyRepository}
+}
+
+func (s *service) CreateAPIKey(ctx context.Context, input CreateAPIKeyInput) (APIKey, string, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Service.CreateAPIKey")
+	defer span.End()
+
+	prefix, err := randomHex(prefixByteLength)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	secret, err := randomHex(secretByteLength)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	plainKey := fmt.Sprintf("%s_%s_%s", keyPrefix, prefix, secret)
+
+	apiKey := APIKey{}
+	apiKey.UserID = input.User.ID
+	apiKey.Name = input.Name
+	apiKey.Prefix = fmt.Sprintf("%s_%s", keyPrefix, prefix)
+	apiKey.KeyHash = hashKey(plainKey)
+	apiKey.Scopes = input.Scopes
+
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		apiKey.ExpiresAt = &expiresAt
+	}
+
+	newAPIKey, err := s.apiKeyRepository.Save(ctx, apiKey)
+	if err != nil {
+		return newAPIKey, "", err
+	}
+
+	return newAPIKey, plainKey, nil
+}
+
+func (s *service) GetAPIKeys(ctx context.Context, userID int) ([]APIKey, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Service.GetAPIKeys")
+	defer span.End()
+
+	apiKeys, err := s.apiKeyRepository.FindByUserID(ctx, userID)
+	if err != nil {
+		return apiKeys, err
+	}
+
+	return apiKeys, nil
+}
+
+func (s *service) RevokeAPIKey(ctx context.Context, input RevokeAPIKeyInput) (APIKey, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Service.RevokeAPIKey")
+	defer span.End()
+
+	apiKey, err := s.apiKeyRepository.FindByID(ctx, input.ID)
+	if err != nil {
+		return apiKey, err
+	}
+
+	// keys of other users are reported as missing rather than forbidden,
+	// so their ids cannot be probed
+	if apiKey.UserID != input.User.ID {
+		return APIKey{}, apperror.NotFound("api key not found")
+	}
+
+	err = s.apiKeyRepository.Revoke(ctx, apiKey.ID)
+	if err != nil {
+		return apiKey, err
+	}
+
+	revokedAPIKey, err := s.apiKeyRepository.FindByID(ctx, apiKey.ID)
+	if err != nil {
+		return revokedAPIKey, err
+	}
+
+	return revokedAPIKey, nil
+}
+
+func (s *service) Authenticate(ctx context.Context, plainKey string) (APIKey, error) {
+	ctx, span := tracing.Start(ctx, "apikey.Service.Authenticate")
+	defer span.End()
+
+	if !strings.HasPrefix(plainKey, keyPrefix+"_") {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	apiKey, err := s.apiKeyRepository.FindByHash(ctx, hashKey(plainKey))
+	if errors.Is(err, apperror.ErrNotFound) {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	if err != nil {
+		return apiKey, err
+	}
+
+	now := time.Now()
+
+	if apiKey.RevokedAt != nil {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return APIKey{}, ErrExpiredKey
+	}
+
+	err = s.apiKeyRepository.TouchLastUsed(ctx, apiKey.ID, now)
+	if err != nil {
+		return apiKey, err
+	}
+
+	apiKey.LastUsedAt = &now
+	return apiKey, nil
+}
+
+func hashKey(plainKey string) string {
+	sum := sha256.Sum256([]byte(plainKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	random := make([]byte, size)
+
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(random), nil
+}
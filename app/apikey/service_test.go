@@ -0,0 +1,89 @@
+package apikey
+
+import (
+	"chi-app/app/user"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestService(t *testing.T) (Service, Repository, user.User) {
+	db := databasetest.NewSQLite(t)
+
+	owner, err := user.NewUserRepository(db).Save(context.Background(), user.User{
+		Name:         "Budi",
+		Occupation:   "Developer",
+		Email:        "budi@example.com",
+		PasswordHash: "hash",
+		Role:         "user",
+	})
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+
+	repo := NewAPIKeyRepository(db)
+	return NewAPIKeyService(repo), repo, owner
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	service, repo, owner := newTestService(t)
+
+	created, plainKey, err := service.CreateAPIKey(ctx, CreateAPIKeyInput{Name: "ci", Scopes: []string{ScopeCampaignsWrite}, User: owner})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if created.KeyHash == plainKey || created.KeyHash != hashKey(plainKey) {
+		t.Fatalf("key not stored as its hash: %+v", created)
+	}
+
+	apiKey, err := service.Authenticate(ctx, plainKey)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+
+	if apiKey.ID != created.ID || apiKey.UserID != owner.ID || !apiKey.HasScope(ScopeCampaignsWrite) {
+		t.Fatalf("unexpected key: %+v", apiKey)
+	}
+
+	stored, err := repo.FindByID(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+
+	if stored.LastUsedAt == nil {
+		t.Fatal("last use not recorded")
+	}
+
+	for _, plainKey := range []string{"", "secret", plainKey + "x", created.Prefix + "_0000"} {
+		_, err := service.Authenticate(ctx, plainKey)
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("authenticate %q: got %v, want ErrInvalidKey", plainKey, err)
+		}
+	}
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expiredKey := "ck_00000000_expired"
+	_, err = repo.Save(ctx, APIKey{UserID: owner.ID, Name: "old", Prefix: "ck_00000000", KeyHash: hashKey(expiredKey), Scopes: []string{ScopeCampaignsWrite}, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("save expired key: %v", err)
+	}
+
+	_, err = service.Authenticate(ctx, expiredKey)
+	if !errors.Is(err, ErrExpiredKey) {
+		t.Fatalf("authenticate expired key: got %v, want ErrExpiredKey", err)
+	}
+
+	_, err = service.RevokeAPIKey(ctx, RevokeAPIKeyInput{ID: created.ID, User: owner})
+	if err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+
+	_, err = service.Authenticate(ctx, plainKey)
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("authenticate revoked key: got %v, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package apperror holds the error kinds shared by the services. Handlers
+// map each kind to an HTTP status, so services never deal with status
+// codes themselves.
+package apperror
+
+import "errors"
+
+var (
+	ErrBadRequest = errors.New("bad request")
+	ErrNotFound   = errors.New("not found")
+	ErrForbidden  = errors.New("forbidden")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+
+	// ErrPreconditionFailed reports a write based on stale data, the
+	// resource changed since the client read it
+	ErrPreconditionFailed = errors.New("precondition failed")
+)
+
+// Error is a domain error whose message is safe to show to the client.
+// errors.Is matches it against its Kind.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func BadRequest(message string) error {
+	return &Error{Kind: ErrBadRequest, Message: message}
+}
+
+func NotFound(message string) error {
+	return &Error{Kind: ErrNotFound, Message: message}
+}
+
+func Forbidden(message string) error {
+	return &Error{Kind: ErrForbidden, Message: message}
+}
+
+func Conflict(message string) error {
+	return &Error{Kind: ErrConflict, Message: message}
+}
+
+func Validation(message string) error {
+	return &Error{Kind: ErrValidation, Message: message}
+}
+
+func PreconditionFailed(message string) error {
+	return &Error{Kind: ErrPreconditionFailed, Message: message}
+}
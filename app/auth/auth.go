@@ -1,8 +1,10 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
-	"os"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
@@ -10,19 +12,32 @@ import (
 type Service interface {
 	GenerateToken(userID int) (string, error)
 	ValidateToken(encodedToken string) (*jwt.Token, error)
+	GenerateChallengeToken(userID int) (string, error)
+	ValidateChallengeToken(encodedToken string) (Challenge, error)
 }
 
-type jwtService struct {
+// Challenge is what a valid challenge token carries. ID is unique per
+// token, the token is spent once it has been exchanged.
+type Challenge struct {
+	ID        string
+	UserID    int
+	ExpiresAt time.Time
 }
 
-func NewJwtService() *jwtService {
-	return &jwtService{}
+// challenge tokens only prove that the password step of a two-factor
+// login succeeded, they are never accepted as access tokens
+const (
+	PurposeTwoFactorChallenge = "2fa_challenge"
+	ChallengeTokenTTL         = 5 * time.Minute
+)
+
+type jwtService struct {
+	secretKey []byte
 }
 
-var (
-	secretKey  = os.Getenv("SECRET_KEY")
-	SECRET_KEY = []byte(secretKey)
-)
+func NewJwtService(secretKey string) *jwtService {
+	return &jwtService{secretKey: []byte(secretKey)}
+}
 
 func (s *jwtService) GenerateToken(userID int) (string, error) {
 	claim := jwt.MapClaims{}
@@ -30,7 +45,7 @@ func (s *jwtService) GenerateToken(userID int) (string, error) {
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
 
-	signedToken, err := token.SignedString(SECRET_KEY)
+	signedToken, err := token.SignedString(s.secretKey)
 	if err != nil {
 		return signedToken, err
 	}
@@ -45,7 +60,7 @@ func (s *jwtService) ValidateToken(encodedToken string) (*jwt.Token, error) {
 			return nil, errors.New("invalid token")
 		}
 
-		return SECRET_KEY, nil
+		return s.secretKey, nil
 	})
 
 	if err != nil {
@@ -54,3 +69,48 @@ func (s *jwtService) ValidateToken(encodedToken string) (*jwt.Token, error) {
 
 	return token, nil
 }
+
+func (s *jwtService) GenerateChallengeToken(userID int) (string, error) {
+	claim := jwt.MapClaims{}
+	claim["user_id"] = userID
+	claim["purpose"] = PurposeTwoFactorChallenge
+	claim["exp"] = time.Now().Add(ChallengeTokenTTL).Unix()
+
+	id := make([]byte, 16)
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	claim["jti"] = hex.EncodeToString(id)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
+
+	signedToken, err := token.SignedString(s.secretKey)
+	if err != nil {
+		return signedToken, err
+	}
+
+	return signedToken, nil
+}
+
+func (s *jwtService) ValidateChallengeToken(encodedToken string) (Challenge, error) {
+	token, err := s.ValidateToken(encodedToken)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	claim, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claim["purpose"] != PurposeTwoFactorChallenge {
+		return Challenge{}, errors.New("invalid challenge token")
+	}
+
+	userID, userOK := claim["user_id"].(float64)
+	id, idOK := claim["jti"].(string)
+	expiresAt, expOK := claim["exp"].(float64)
+	if !userOK || !idOK || id == "" || !expOK {
+		return Challenge{}, errors.New("invalid challenge token")
+	}
+
+	return Challenge{ID: id, UserID: int(userID), ExpiresAt: time.Unix(int64(expiresAt), 0)}, nil
+}
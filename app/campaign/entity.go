@@ -2,6 +2,8 @@ package campaign
 
 import (
 	"chi-app/app/user"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,7 +21,7 @@ type Campaign struct {
 	CreatedAt        time.Time       `json:"created_at"`
 	UpdatedAt        time.Time       `json:"updated_at"`
 	CampaignImages   []CampaignImage `json:"campaign_images"`
-	User             user.User       `json:"user"`
+	User             user.User       `json:"-"`
 }
 
 type CampaignImage struct {
@@ -30,3 +32,44 @@ type CampaignImage struct {
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
+
+type CreatorSummary struct {
+	CampaignCount int
+	TotalRaised   int
+}
+
+// LastModified is the latest change to the campaign or one of its
+// images. The owner's name and avatar are left out, the campaign is
+// versioned on its own rows only.
+func (c Campaign) LastModified() time.Time {
+	lastModified := c.UpdatedAt
+	for _, campaignImage := range c.CampaignImages {
+		if campaignImage.UpdatedAt.After(lastModified) {
+			lastModified = campaignImage.UpdatedAt
+		}
+	}
+
+	return lastModified
+}
+
+// ETag is a weak entity tag carrying LastModified, ParseETag reads it
+// back for If-Match.
+func (c Campaign) ETag() string {
+	return `W/"` + strconv.FormatInt(c.LastModified().UnixNano(), 36) + `"`
+}
+
+// ParseETag returns the LastModified an ETag was made from. The W/ prefix
+// is optional, clients may send the tag back either way.
+func ParseETag(etag string) (time.Time, bool) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(etag[1:len(etag)-1], 36, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, nanos), true
+}
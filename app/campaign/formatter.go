@@ -1,7 +1,9 @@
 package campaign
 
 import (
+	"chi-app/app/user"
 	"strings"
+	"time"
 )
 
 type CampaignFormatter struct {
@@ -27,7 +29,7 @@ func FormatCampaign(campaign Campaign) CampaignFormatter {
 	formatter.UserID = campaign.UserID
 
 	if len(campaign.CampaignImages) > 0 {
-		formatter.ImageURL = campaign.CampaignImages[0].FileName
+		formatter.ImageURL = imageURL(campaign.CampaignImages[0].FileName)
 	}
 
 	return formatter
@@ -86,11 +88,11 @@ func FormatCampaignDetail(campaign Campaign) CampaignDetailFormatter {
 	imagesFormatter := []CampaignImageFormatter{}
 	for _, campaignImage := range campaign.CampaignImages {
 		if campaignImage.IsPrimary {
-			formatter.ImageURL = campaignImage.FileName
+			formatter.ImageURL = imageURL(campaignImage.FileName)
 		}
 
 		imageFormatter := CampaignImageFormatter{}
-		imageFormatter.ImageURL = campaignImage.FileName
+		imageFormatter.ImageURL = imageURL(campaignImage.FileName)
 		imageFormatter.IsPrimary = campaignImage.IsPrimary
 		imagesFormatter = append(imagesFormatter, imageFormatter)
 	}
@@ -101,9 +103,72 @@ func FormatCampaignDetail(campaign Campaign) CampaignDetailFormatter {
 
 	userFormatter := CampaignUserFormatter{}
 	userFormatter.Name = campaign.User.Name
-	userFormatter.ImageURL = campaign.User.AvatarFileName
+	userFormatter.ImageURL = imageURL(campaign.User.AvatarFileName)
 
 	formatter.Images = imagesFormatter
 	formatter.User = userFormatter
 	return formatter
 }
+
+// CreatorProfileFormatter is the public view of a campaign owner. It is
+// built field by field from user.User so private columns such as the
+// email address or password hash can never end up in the response.
+type CreatorProfileFormatter struct {
+	ID            int                 `json:"id"`
+	Name          string              `json:"name"`
+	Occupation    string              `json:"occupation"`
+	ImageURL      string              `json:"image_url"`
+	Bio           string              `json:"bio"`
+	JoinedAt      time.Time           `json:"joined_at"`
+	CampaignCount int                 `json:"campaign_count"`
+	TotalRaised   int                 `json:"total_raised"`
+	Campaigns     []CampaignFormatter `json:"campaigns"`
+	Pagination    PaginationFormatter `json:"pagination"`
+}
+
+type PaginationFormatter struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	Total      int `json:"total"`
+	TotalPages int `json:"total_pages"`
+}
+
+func FormatPagination(page int, perPage int, total int) PaginationFormatter {
+	formatter := PaginationFormatter{}
+	formatter.Page = page
+	formatter.PerPage = perPage
+	formatter.Total = total
+	formatter.TotalPages = 0
+
+	if perPage > 0 {
+		formatter.TotalPages = (total + perPage - 1) / perPage
+	}
+
+	return formatter
+}
+
+func FormatCreatorProfile(creator user.User, summary CreatorSummary, campaigns []Campaign, input GetCreatorCampaignsInput) CreatorProfileFormatter {
+	formatter := CreatorProfileFormatter{}
+	formatter.ID = creator.ID
+	formatter.Name = creator.Name
+	formatter.Occupation = creator.Occupation
+	formatter.ImageURL = imageURL(creator.AvatarFileName)
+	formatter.Bio = creator.Bio
+	formatter.JoinedAt = creator.CreatedAt
+	formatter.CampaignCount = summary.CampaignCount
+	formatter.TotalRaised = summary.TotalRaised
+	formatter.Campaigns = FormatCampaigns(campaigns)
+	formatter.Pagination = FormatPagination(input.Page, input.PerPage, summary.CampaignCount)
+
+	return formatter
+}
+
+// imageURL is where the file of an upload is served, empty when there is
+// no file.
+func imageURL(fileName string) string {
+	if fileName == "" {
+		return ""
+	}
+
+	return "/images/" + fileName
+}
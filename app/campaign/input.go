@@ -1,16 +1,38 @@
 package campaign
 
-import "chi-app/app/user"
+import (
+	"chi-app/app/user"
+	"mime/multipart"
+	"time"
+)
 
 type GetCampaignDetailInput struct {
 	ID int `uri:"id" validate:"required"`
 }
 
 type CreateCampaignInput struct {
-	Name             string `json:"name" validate:"required"`
-	ShortDescription string `json:"short_description" validate:"required"`
-	Description      string `json:"description" validate:"required"`
-	Perks            string `json:"perks" validate:"required"`
-	GoalAmount       int    `json:"goal_amount" validate:"required"`
-	User             user.User
+	Name             string    `json:"name" validate:"required"`
+	ShortDescription string    `json:"short_description" validate:"required"`
+	Description      string    `json:"description" validate:"required"`
+	Perks            string    `json:"perks" validate:"required"`
+	GoalAmount       int       `json:"goal_amount" validate:"required,currency"`
+	User             user.User `json:"-"`
+
+	// ExpectedVersions are the LastModified values of the campaign the
+	// client accepts, taken from If-Match. The update goes through when
+	// any of them is current, nil updates whatever is stored.
+	ExpectedVersions []time.Time `json:"-"`
+}
+
+type GetCreatorCampaignsInput struct {
+	UserID  int `uri:"id" validate:"required"`
+	Page    int `query:"page" validate:"min=1"`
+	PerPage int `query:"per_page" validate:"min=1,max=50"`
+}
+
+type CreateCampaignImageInput struct {
+	CampaignID int                   `form:"campaign_id" validate:"required"`
+	IsPrimary  bool                  `form:"is_primary"`
+	File       *multipart.FileHeader `form:"file" validate:"required"`
+	User       user.User
 }
@@ -0,0 +1,249 @@
+package campaign
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/app/user"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryRepository keeps campaigns in process memory. Owners are looked
+// up in the given user repository, the way the SQL repository joins the
+// users table.
+type memoryRepository struct {
+	mu             sync.RWMutex
+	userRepository user.Repository
+	campaigns      map[int]Campaign
+	lastCampaignID int
+	images         map[int]CampaignImage
+	lastImageID    int
+}
+
+func NewMemoryCampaignRepository(userRepository user.Repository) Repository {
+	return &memoryRepository{
+		userRepository: userRepository,
+		campaigns:      map[int]Campaign{},
+		images:         map[int]CampaignImage{},
+	}
+}
+
+func (r *memoryRepository) Save(ctx context.Context, campaign Campaign) (Campaign, error) {
+	_, err := r.userRepository.FindByID(ctx, campaign.UserID)
+	if err != nil {
+		return campaign, err
+	}
+
+	r.mu.Lock()
+
+	now := time.Now().UTC()
+
+	r.lastCampaignID++
+	campaign.ID = r.lastCampaignID
+	campaign.CreatedAt = now
+	campaign.UpdatedAt = now
+	campaign.CampaignImages = nil
+	campaign.User = user.User{}
+
+	r.campaigns[campaign.ID] = campaign
+	r.mu.Unlock()
+
+	return r.GetCampaignByID(ctx, campaign.ID)
+}
+
+func (r *memoryRepository) GetCampaignByID(ctx context.Context, ID int) (Campaign, error) {
+	r.mu.RLock()
+	campaign, ok := r.campaigns[ID]
+	r.mu.RUnlock()
+
+	if !ok {
+		return Campaign{}, apperror.NotFound("campaign not found")
+	}
+
+	owner, err := r.userRepository.FindByID(ctx, campaign.UserID)
+	if errors.Is(err, apperror.ErrNotFound) {
+		return Campaign{}, apperror.NotFound("campaign not found")
+	}
+
+	if err != nil {
+		return Campaign{}, err
+	}
+
+	campaignImages, err := r.FindCampaignImagesByCampaignID(ctx, campaign.ID)
+	if err != nil {
+		return campaign, err
+	}
+
+	campaign.CampaignImages = campaignImages
+	campaign.User = user.User{Name: owner.Name, AvatarFileName: owner.AvatarFileName}
+
+	return campaign, nil
+}
+
+func (r *memoryRepository) GetCampaigns(ctx context.Context) ([]Campaign, error) {
+	return r.findCampaigns(func(campaign Campaign) bool {
+		return true
+	}), nil
+}
+
+func (r *memoryRepository) GetCampaignsByUserID(ctx context.Context, userID int) ([]Campaign, error) {
+	return r.findCampaigns(func(campaign Campaign) bool {
+		return campaign.UserID == userID
+	}), nil
+}
+
+func (r *memoryRepository) GetCampaignsByUserIDPaginated(ctx context.Context, userID int, limit int, offset int) ([]Campaign, error) {
+	campaigns := r.findCampaigns(func(campaign Campaign) bool {
+		return campaign.UserID == userID
+	})
+
+	sort.SliceStable(campaigns, func(i, j int) bool {
+		if !campaigns[i].CreatedAt.Equal(campaigns[j].CreatedAt) {
+			return campaigns[i].CreatedAt.After(campaigns[j].CreatedAt)
+		}
+
+		return campaigns[i].ID > campaigns[j].ID
+	})
+
+	if offset >= len(campaigns) {
+		return []Campaign{}, nil
+	}
+
+	campaigns = campaigns[offset:]
+	if limit < len(campaigns) {
+		campaigns = campaigns[:limit]
+	}
+
+	return campaigns, nil
+}
+
+func (r *memoryRepository) GetCreatorSummary(ctx context.Context, userID int) (CreatorSummary, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	summary := CreatorSummary{}
+	for _, campaign := range r.campaigns {
+		if campaign.UserID == userID {
+			summary.CampaignCount++
+			summary.TotalRaised += campaign.CurrentAmount
+		}
+	}
+
+	return summary, nil
+}
+
+func (r *memoryRepository) findCampaigns(match func(campaign Campaign) bool) []Campaign {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	campaigns := []Campaign{}
+	for _, campaign := range r.campaigns {
+		if match(campaign) {
+			campaign.CampaignImages = r.campaignImages(campaign.ID)
+			campaigns = append(campaigns, campaign)
+		}
+	}
+
+	sort.Slice(campaigns, func(i, j int) bool {
+		return campaigns[i].ID < campaigns[j].ID
+	})
+
+	return campaigns
+}
+
+func (r *memoryRepository) FindCampaignImagesByCampaignID(ctx context.Context, campaignID int) ([]CampaignImage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.campaignImages(campaignID), nil
+}
+
+func (r *memoryRepository) campaignImages(campaignID int) []CampaignImage {
+	campaignImages := []CampaignImage{}
+	for _, campaignImage := range r.images {
+		if campaignImage.CampaignID == campaignID {
+			campaignImages = append(campaignImages, campaignImage)
+		}
+	}
+
+	sort.Slice(campaignImages, func(i, j int) bool {
+		return campaignImages[i].ID < campaignImages[j].ID
+	})
+
+	return campaignImages
+}
+
+func (r *memoryRepository) Update(ctx context.Context, campaign Campaign) (Campaign, error) {
+	return r.update(ctx, campaign, false)
+}
+
+func (r *memoryRepository) UpdateIfUnchanged(ctx context.Context, campaign Campaign) (Campaign, error) {
+	return r.update(ctx, campaign, true)
+}
+
+func (r *memoryRepository) update(ctx context.Context, campaign Campaign, ifUnchanged bool) (Campaign, error) {
+	r.mu.Lock()
+
+	existing, ok := r.campaigns[campaign.ID]
+	if !ok {
+		r.mu.Unlock()
+		return Campaign{}, apperror.NotFound("campaign not found")
+	}
+
+	if ifUnchanged && !existing.UpdatedAt.Equal(campaign.UpdatedAt) {
+		r.mu.Unlock()
+		return Campaign{}, apperror.PreconditionFailed("campaign has been changed since it was read")
+	}
+
+	existing.Name = campaign.Name
+	existing.ShortDescription = campaign.ShortDescription
+	existing.Description = campaign.Description
+	existing.Perks = campaign.Perks
+	existing.BackerCount = campaign.BackerCount
+	existing.GoalAmount = campaign.GoalAmount
+	existing.CurrentAmount = campaign.CurrentAmount
+	existing.Slug = campaign.Slug
+	existing.UpdatedAt = time.Now().UTC()
+
+	r.campaigns[campaign.ID] = existing
+	r.mu.Unlock()
+
+	return r.GetCampaignByID(ctx, campaign.ID)
+}
+
+func (r *memoryRepository) SaveImage(ctx context.Context, campaignImage CampaignImage) (CampaignImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.campaigns[campaignImage.CampaignID]; !ok {
+		return campaignImage, errors.New("campaign does not exist")
+	}
+
+	now := time.Now().UTC()
+
+	r.lastImageID++
+	campaignImage.ID = r.lastImageID
+	campaignImage.CreatedAt = now
+	campaignImage.UpdatedAt = now
+
+	r.images[campaignImage.ID] = campaignImage
+	return campaignImage, nil
+}
+
+func (r *memoryRepository) MarkAllImagesAsNonPrimary(ctx context.Context, campaignID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	for ID, campaignImage := range r.images {
+		if campaignImage.CampaignID == campaignID && campaignImage.IsPrimary {
+			campaignImage.IsPrimary = false
+			campaignImage.UpdatedAt = now
+			r.images[ID] = campaignImage
+		}
+	}
+
+	return nil
+}
@@ -1,37 +1,60 @@
 package campaign
 
 import (
+	"chi-app/app/apperror"
+	"chi-app/app/tracing"
 	"chi-app/app/user"
-	"database/sql"
-	"errors"
+	"chi-app/database"
+	"context"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
 type Repository interface {
-	Save(campaign Campaign) (Campaign, error)
-	GetCampaignByID(ID int) (Campaign, error)
-	GetCampaigns() ([]Campaign, error)
-	GetCampaignsByUserID(userID int) ([]Campaign, error)
-	FindCampaignImagesByCampaignID(campaignID int) ([]CampaignImage, error)
-	Update(campaign Campaign) (Campaign, error)
+	Save(ctx context.Context, campaign Campaign) (Campaign, error)
+	GetCampaignByID(ctx context.Context, ID int) (Campaign, error)
+	GetCampaigns(ctx context.Context) ([]Campaign, error)
+	GetCampaignsByUserID(ctx context.Context, userID int) ([]Campaign, error)
+	GetCampaignsByUserIDPaginated(ctx context.Context, userID int, limit int, offset int) ([]Campaign, error)
+	GetCreatorSummary(ctx context.Context, userID int) (CreatorSummary, error)
+	FindCampaignImagesByCampaignID(ctx context.Context, campaignID int) ([]CampaignImage, error)
+	Update(ctx context.Context, campaign Campaign) (Campaign, error)
+	UpdateIfUnchanged(ctx context.Context, campaign Campaign) (Campaign, error)
+	SaveImage(ctx context.Context, campaignImage CampaignImage) (CampaignImage, error)
+	MarkAllImagesAsNonPrimary(ctx context.Context, campaignID int) error
 }
 
 type repository struct {
-	DB *sql.DB
+	DB *database.DB
 }
 
-const (
-	layoutDateTime string = "2006-01-02 15:04:05"
-)
+var campaignColumns = []string{
+	"id",
+	"user_id",
+	"name",
+	"short_description",
+	"description",
+	"perks",
+	"backer_count",
+	"goal_amount",
+	"current_amount",
+	"slug",
+	"created_at",
+	"updated_at",
+}
 
-func NewCampaignRepository(DB *sql.DB) Repository {
+func NewCampaignRepository(DB *database.DB) Repository {
 	return &repository{DB}
 }
 
-func (r *repository) Save(campaign Campaign) (Campaign, error) {
-	sqlQuery := sq.Insert("campaigns").Columns(
+func (r *repository) Save(ctx context.Context, campaign Campaign) (Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.Save")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	sqlQuery := r.DB.Builder().Insert("campaigns").Columns(
 		"user_id",
 		"name",
 		"short_description",
@@ -53,21 +76,15 @@ func (r *repository) Save(campaign Campaign) (Campaign, error) {
 			campaign.GoalAmount,
 			campaign.CurrentAmount,
 			campaign.Slug,
-			time.Now().Format(layoutDateTime),
-			time.Now().Format(layoutDateTime)).
-		RunWith(r.DB)
-
-	result, err := sqlQuery.Exec()
-	if err != nil {
-		return campaign, err
-	}
+			now,
+			now)
 
-	campaignID, err := result.LastInsertId()
+	campaignID, err := r.DB.InsertReturningID(ctx, sqlQuery)
 	if err != nil {
 		return campaign, err
 	}
 
-	newCampaign, err := r.GetCampaignByID(int(campaignID))
+	newCampaign, err := r.GetCampaignByID(ctx, int(campaignID))
 	if err != nil {
 		return newCampaign, err
 	}
@@ -75,11 +92,14 @@ func (r *repository) Save(campaign Campaign) (Campaign, error) {
 	return newCampaign, nil
 }
 
-func (r *repository) GetCampaignByID(ID int) (Campaign, error) {
+func (r *repository) GetCampaignByID(ctx context.Context, ID int) (Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.GetCampaignByID")
+	defer span.End()
+
 	campaign := Campaign{}
 	user := user.User{}
 
-	sqlQuery := sq.Select(
+	sqlQuery := r.DB.Builder().Select(
 		"campaigns.id",
 		"campaigns.user_id",
 		"campaigns.name",
@@ -98,126 +118,116 @@ func (r *repository) GetCampaignByID(ID int) (Campaign, error) {
 		Join("users ON users.id = campaigns.user_id").
 		Where(sq.Eq{"campaigns.id": ID})
 
-	rows, err := sqlQuery.RunWith(r.DB).Query()
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
 	if err != nil {
 		return campaign, err
 	}
 
 	defer rows.Close()
 
-	if rows.Next() {
-		err := rows.Scan(
-			&campaign.ID,
-			&campaign.UserID,
-			&campaign.Name,
-			&campaign.ShortDescription,
-			&campaign.Description,
-			&campaign.Perks,
-			&campaign.BackerCount,
-			&campaign.GoalAmount,
-			&campaign.CurrentAmount,
-			&campaign.Slug,
-			&campaign.CreatedAt,
-			&campaign.UpdatedAt,
-			&user.Name,
-			&user.AvatarFileName,
-		)
-
-		if err != nil {
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
 			return campaign, err
 		}
 
-		campaignImages, err := r.FindCampaignImagesByCampaignID(campaign.ID)
-		if err != nil {
-			return campaign, err
-		}
+		return campaign, apperror.NotFound("campaign not found")
+	}
 
-		campaign.CampaignImages = campaignImages
+	err = rows.Scan(
+		&campaign.ID,
+		&campaign.UserID,
+		&campaign.Name,
+		&campaign.ShortDescription,
+		&campaign.Description,
+		&campaign.Perks,
+		&campaign.BackerCount,
+		&campaign.GoalAmount,
+		&campaign.CurrentAmount,
+		&campaign.Slug,
+		&campaign.CreatedAt,
+		&campaign.UpdatedAt,
+		&user.Name,
+		&user.AvatarFileName,
+	)
+	if err != nil {
+		return Campaign{}, err
 	}
 
+	// the images are loaded on their own query, so the rows are
+	// released first
+	rows.Close()
+
+	campaignImages, err := r.FindCampaignImagesByCampaignID(ctx, campaign.ID)
+	if err != nil {
+		return campaign, err
+	}
+
+	campaign.CampaignImages = campaignImages
 	campaign.User = user
 	return campaign, nil
 }
 
-func (r *repository) GetCampaigns() ([]Campaign, error) {
-	campaigns := []Campaign{}
+func (r *repository) GetCampaigns(ctx context.Context) ([]Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.GetCampaigns")
+	defer span.End()
 
-	sqlQuery := sq.Select(
-		"id",
-		"user_id",
-		"name",
-		"short_description",
-		"description",
-		"perks",
-		"backer_count",
-		"goal_amount",
-		"current_amount",
-		"slug",
-		"created_at",
-		"updated_at").
-		From("campaigns")
-
-	rows, err := sqlQuery.RunWith(r.DB).Query()
-	if err != nil {
-		return campaigns, err
-	}
+	sqlQuery := r.DB.Builder().Select(campaignColumns...).
+		From("campaigns").
+		OrderBy("id")
 
-	defer rows.Close()
+	return r.findCampaigns(ctx, sqlQuery)
+}
 
-	for rows.Next() {
-		campaign := Campaign{}
+func (r *repository) GetCampaignsByUserID(ctx context.Context, userID int) ([]Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.GetCampaignsByUserID")
+	defer span.End()
 
-		err := rows.Scan(
-			&campaign.ID,
-			&campaign.UserID,
-			&campaign.Name,
-			&campaign.ShortDescription,
-			&campaign.Description,
-			&campaign.Perks,
-			&campaign.BackerCount,
-			&campaign.GoalAmount,
-			&campaign.CurrentAmount,
-			&campaign.Slug,
-			&campaign.CreatedAt,
-			&campaign.UpdatedAt,
-		)
+	sqlQuery := r.DB.Builder().Select(campaignColumns...).
+		From("campaigns").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("id")
 
-		if err != nil {
-			return campaigns, err
-		}
+	return r.findCampaigns(ctx, sqlQuery)
+}
 
-		campaignImages, err := r.FindCampaignImagesByCampaignID(campaign.ID)
-		if err != nil {
-			return campaigns, err
-		}
+func (r *repository) GetCampaignsByUserIDPaginated(ctx context.Context, userID int, limit int, offset int) ([]Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.GetCampaignsByUserIDPaginated")
+	defer span.End()
 
-		campaign.CampaignImages = campaignImages
-		campaigns = append(campaigns, campaign)
-	}
+	sqlQuery := r.DB.Builder().Select(campaignColumns...).
+		From("campaigns").
+		Where(sq.Eq{"user_id": userID}).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset))
 
-	return campaigns, nil
+	return r.findCampaigns(ctx, sqlQuery)
 }
 
-func (r *repository) GetCampaignsByUserID(userID int) ([]Campaign, error) {
-	campaigns := []Campaign{}
+func (r *repository) GetCreatorSummary(ctx context.Context, userID int) (CreatorSummary, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.GetCreatorSummary")
+	defer span.End()
 
-	sqlQuery := sq.Select(
-		"id",
-		"user_id",
-		"name",
-		"short_description",
-		"description",
-		"perks",
-		"backer_count",
-		"goal_amount",
-		"current_amount",
-		"slug",
-		"created_at",
-		"updated_at").
+	summary := CreatorSummary{}
+
+	sqlQuery := r.DB.Builder().Select(
+		"COUNT(id)",
+		"COALESCE(SUM(current_amount), 0)").
 		From("campaigns").
 		Where(sq.Eq{"user_id": userID})
 
-	rows, err := sqlQuery.RunWith(r.DB).Query()
+	err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryRowContext(ctx).Scan(&summary.CampaignCount, &summary.TotalRaised)
+	if err != nil {
+		return summary, err
+	}
+
+	return summary, nil
+}
+
+func (r *repository) findCampaigns(ctx context.Context, sqlQuery sq.SelectBuilder) ([]Campaign, error) {
+	campaigns := []Campaign{}
+
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
 	if err != nil {
 		return campaigns, err
 	}
@@ -246,7 +256,7 @@ func (r *repository) GetCampaignsByUserID(userID int) ([]Campaign, error) {
 			return campaigns, err
 		}
 
-		campaignImages, err := r.FindCampaignImagesByCampaignID(campaign.ID)
+		campaignImages, err := r.FindCampaignImagesByCampaignID(ctx, campaign.ID)
 		if err != nil {
 			return campaigns, err
 		}
@@ -255,13 +265,16 @@ func (r *repository) GetCampaignsByUserID(userID int) ([]Campaign, error) {
 		campaigns = append(campaigns, campaign)
 	}
 
-	return campaigns, nil
+	return campaigns, rows.Err()
 }
 
-func (r *repository) FindCampaignImagesByCampaignID(campaignID int) ([]CampaignImage, error) {
+func (r *repository) FindCampaignImagesByCampaignID(ctx context.Context, campaignID int) ([]CampaignImage, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.FindCampaignImagesByCampaignID")
+	defer span.End()
+
 	campaignImages := []CampaignImage{}
 
-	sqlQuery := sq.Select(
+	sqlQuery := r.DB.Builder().Select(
 		"id",
 		"campaign_id",
 		"file_name",
@@ -269,9 +282,10 @@ func (r *repository) FindCampaignImagesByCampaignID(campaignID int) ([]CampaignI
 		"created_at",
 		"updated_at").
 		From("campaign_images").
-		Where(sq.Eq{"campaign_id": campaignID})
+		Where(sq.Eq{"campaign_id": campaignID}).
+		OrderBy("id")
 
-	rows, err := sqlQuery.RunWith(r.DB).Query()
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
 	if err != nil {
 		return campaignImages, err
 	}
@@ -279,60 +293,134 @@ func (r *repository) FindCampaignImagesByCampaignID(campaignID int) ([]CampaignI
 	defer rows.Close()
 
 	for rows.Next() {
-		var isPrimaryNum int
 		campaignImage := CampaignImage{}
 
-		rows.Scan(
+		err := rows.Scan(
 			&campaignImage.ID,
 			&campaignImage.CampaignID,
 			&campaignImage.FileName,
-			&isPrimaryNum,
+			&campaignImage.IsPrimary,
 			&campaignImage.CreatedAt,
 			&campaignImage.UpdatedAt,
 		)
 
-		isPrimary := false
-		if isPrimaryNum == 1 {
-			isPrimary = true
+		if err != nil {
+			return campaignImages, err
 		}
 
-		campaignImage.IsPrimary = isPrimary
 		campaignImages = append(campaignImages, campaignImage)
 	}
 
-	return campaignImages, nil
+	return campaignImages, rows.Err()
+}
+
+func (r *repository) Update(ctx context.Context, campaign Campaign) (Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.Update")
+	defer span.End()
+
+	updated, err := r.update(ctx, campaign, sq.Eq{"id": campaign.ID})
+	if err != nil {
+		return campaign, err
+	}
+
+	if !updated {
+		return Campaign{}, apperror.NotFound("campaign not found")
+	}
+
+	return r.GetCampaignByID(ctx, campaign.ID)
+}
+
+// UpdateIfUnchanged only writes the campaign while its row still has the
+// UpdatedAt campaign was read with, a concurrent update in between makes
+// it fail instead of being overwritten.
+func (r *repository) UpdateIfUnchanged(ctx context.Context, campaign Campaign) (Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.UpdateIfUnchanged")
+	defer span.End()
+
+	updated, err := r.update(ctx, campaign, sq.Eq{"id": campaign.ID, "updated_at": campaign.UpdatedAt})
+	if err != nil {
+		return campaign, err
+	}
+
+	if !updated {
+		return Campaign{}, apperror.PreconditionFailed("campaign has been changed since it was read")
+	}
+
+	return r.GetCampaignByID(ctx, campaign.ID)
 }
 
-func (r *repository) Update(campaign Campaign) (Campaign, error) {
-	sqlQuery := sq.Update("campaigns").
+func (r *repository) update(ctx context.Context, campaign Campaign, where sq.Eq) (bool, error) {
+	sqlQuery := r.DB.Builder().Update("campaigns").
 		Set("name", campaign.Name).
 		Set("short_description", campaign.ShortDescription).
+		Set("description", campaign.Description).
 		Set("perks", campaign.Perks).
 		Set("backer_count", campaign.BackerCount).
 		Set("goal_amount", campaign.GoalAmount).
 		Set("current_amount", campaign.CurrentAmount).
 		Set("slug", campaign.Slug).
-		Set("updated_at", time.Now().Format(layoutDateTime)).
-		Where(sq.Eq{"id": campaign.ID}).RunWith(r.DB)
+		Set("updated_at", time.Now().UTC()).
+		Where(where).RunWith(r.DB.Runner(ctx))
 
-	result, err := sqlQuery.Exec()
+	result, err := sqlQuery.ExecContext(ctx)
 	if err != nil {
-		return campaign, err
+		return false, err
 	}
 
 	affected, err := result.RowsAffected()
 	if err != nil {
-		return campaign, err
+		return false, err
 	}
 
-	if int(affected) > 0 {
-		updatedCampaign, err := r.GetCampaignByID(campaign.ID)
-		if err != nil {
-			return updatedCampaign, err
-		}
+	return affected > 0, nil
+}
+
+func (r *repository) SaveImage(ctx context.Context, campaignImage CampaignImage) (CampaignImage, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.SaveImage")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	sqlQuery := r.DB.Builder().Insert("campaign_images").
+		Columns(
+			"campaign_id",
+			"file_name",
+			"is_primary",
+			"created_at",
+			"updated_at").
+		Values(
+			campaignImage.CampaignID,
+			campaignImage.FileName,
+			campaignImage.IsPrimary,
+			now,
+			now)
+
+	imageID, err := r.DB.InsertReturningID(ctx, sqlQuery)
+	if err != nil {
+		return campaignImage, err
+	}
+
+	campaignImage.ID = int(imageID)
+	campaignImage.CreatedAt = now
+	campaignImage.UpdatedAt = now
+
+	return campaignImage, nil
+}
 
-		return updatedCampaign, nil
-	} else {
-		return Campaign{}, errors.New("failed to update campaign")
+func (r *repository) MarkAllImagesAsNonPrimary(ctx context.Context, campaignID int) error {
+	ctx, span := tracing.Start(ctx, "campaign.Repository.MarkAllImagesAsNonPrimary")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Update("campaign_images").
+		Set("is_primary", false).
+		Set("updated_at", time.Now().UTC()).
+		Where(sq.Eq{"campaign_id": campaignID, "is_primary": true}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlQuery.ExecContext(ctx)
+	if err != nil {
+		return err
 	}
+
+	return nil
 }
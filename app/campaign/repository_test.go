@@ -0,0 +1,306 @@
+package campaign
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/app/user"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) (Repository, user.Repository) {
+		userRepository := user.NewMemoryUserRepository()
+		return NewMemoryCampaignRepository(userRepository), userRepository
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) (Repository, user.Repository) {
+		db := databasetest.NewSQLite(t)
+		return NewCampaignRepository(db), user.NewUserRepository(db)
+	})
+}
+
+// testRepository is the contract every Repository implementation has to
+// satisfy. Owners are created through the user repository that belongs to
+// the same store.
+func testRepository(t *testing.T, newRepository func(t *testing.T) (Repository, user.Repository)) {
+	ctx := context.Background()
+
+	newOwner := func(t *testing.T, userRepository user.Repository, email string) user.User {
+		owner, err := userRepository.Save(ctx, user.User{Name: "Budi", Email: email, AvatarFileName: "budi.png", Role: "user"})
+		if err != nil {
+			t.Fatalf("save owner: %v", err)
+		}
+
+		return owner
+	}
+
+	newCampaign := func(t *testing.T, repo Repository, ownerID int, name string) Campaign {
+		campaign, err := repo.Save(ctx, Campaign{
+			UserID:           ownerID,
+			Name:             name,
+			ShortDescription: "short",
+			Description:      "description",
+			Perks:            "perks",
+			GoalAmount:       1000,
+			Slug:             name,
+		})
+		if err != nil {
+			t.Fatalf("save campaign: %v", err)
+		}
+
+		return campaign
+	}
+
+	t.Run("save joins owner", func(t *testing.T) {
+		repo, userRepository := newRepository(t)
+		owner := newOwner(t, userRepository, "budi@example.com")
+
+		campaign := newCampaign(t, repo, owner.ID, "first")
+
+		if campaign.ID == 0 || campaign.CreatedAt.IsZero() || campaign.UpdatedAt.IsZero() {
+			t.Fatalf("campaign not stored: %+v", campaign)
+		}
+
+		if campaign.UserID != owner.ID || campaign.User.Name != "Budi" || campaign.User.AvatarFileName != "budi.png" {
+			t.Fatalf("owner not joined: %+v", campaign.User)
+		}
+
+		if campaign.CampaignImages == nil || len(campaign.CampaignImages) != 0 {
+			t.Fatalf("want empty images, got %+v", campaign.CampaignImages)
+		}
+	})
+
+	t.Run("save requires owner", func(t *testing.T) {
+		repo, _ := newRepository(t)
+
+		_, err := repo.Save(ctx, Campaign{UserID: 42, Name: "orphan", Slug: "orphan"})
+		if err == nil {
+			t.Fatal("saved a campaign without an owner")
+		}
+	})
+
+	t.Run("missing campaign", func(t *testing.T) {
+		repo, _ := newRepository(t)
+
+		_, err := repo.GetCampaignByID(ctx, 42)
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("get: got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repo, userRepository := newRepository(t)
+		budi := newOwner(t, userRepository, "budi@example.com")
+		sari := newOwner(t, userRepository, "sari@example.com")
+
+		first := newCampaign(t, repo, budi.ID, "first")
+		second := newCampaign(t, repo, sari.ID, "second")
+		third := newCampaign(t, repo, budi.ID, "third")
+
+		campaigns, err := repo.GetCampaigns(ctx)
+		if err != nil {
+			t.Fatalf("get campaigns: %v", err)
+		}
+
+		if ids := campaignIDs(campaigns); ids != fmt.Sprint([]int{first.ID, second.ID, third.ID}) {
+			t.Fatalf("got campaigns %s", ids)
+		}
+
+		campaigns, err = repo.GetCampaignsByUserID(ctx, budi.ID)
+		if err != nil {
+			t.Fatalf("get campaigns by user: %v", err)
+		}
+
+		if ids := campaignIDs(campaigns); ids != fmt.Sprint([]int{first.ID, third.ID}) {
+			t.Fatalf("got campaigns %s", ids)
+		}
+
+		campaigns, err = repo.GetCampaignsByUserID(ctx, 42)
+		if err != nil {
+			t.Fatalf("get campaigns by unknown user: %v", err)
+		}
+
+		if campaigns == nil || len(campaigns) != 0 {
+			t.Fatalf("want empty list, got %+v", campaigns)
+		}
+	})
+
+	t.Run("paginate and summarize", func(t *testing.T) {
+		repo, userRepository := newRepository(t)
+		owner := newOwner(t, userRepository, "budi@example.com")
+
+		ids := []int{}
+		for i := 0; i < 5; i++ {
+			campaign := newCampaign(t, repo, owner.ID, fmt.Sprintf("campaign-%d", i))
+			campaign.CurrentAmount = 100 * (i + 1)
+
+			_, err := repo.Update(ctx, campaign)
+			if err != nil {
+				t.Fatalf("update: %v", err)
+			}
+
+			ids = append(ids, campaign.ID)
+		}
+
+		page, err := repo.GetCampaignsByUserIDPaginated(ctx, owner.ID, 2, 2)
+		if err != nil {
+			t.Fatalf("paginate: %v", err)
+		}
+
+		if got := campaignIDs(page); got != fmt.Sprint([]int{ids[2], ids[1]}) {
+			t.Fatalf("got page %s", got)
+		}
+
+		page, err = repo.GetCampaignsByUserIDPaginated(ctx, owner.ID, 2, 10)
+		if err != nil {
+			t.Fatalf("paginate past the end: %v", err)
+		}
+
+		if len(page) != 0 {
+			t.Fatalf("want empty page, got %s", campaignIDs(page))
+		}
+
+		summary, err := repo.GetCreatorSummary(ctx, owner.ID)
+		if err != nil {
+			t.Fatalf("summary: %v", err)
+		}
+
+		if summary.CampaignCount != 5 || summary.TotalRaised != 1500 {
+			t.Fatalf("unexpected summary: %+v", summary)
+		}
+
+		summary, err = repo.GetCreatorSummary(ctx, 42)
+		if err != nil {
+			t.Fatalf("summary for unknown user: %v", err)
+		}
+
+		if summary.CampaignCount != 0 || summary.TotalRaised != 0 {
+			t.Fatalf("unexpected summary: %+v", summary)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo, userRepository := newRepository(t)
+		owner := newOwner(t, userRepository, "budi@example.com")
+		campaign := newCampaign(t, repo, owner.ID, "first")
+
+		campaign.Name = "renamed"
+		campaign.Description = "new description"
+		campaign.GoalAmount = 5000
+		campaign.Slug = "renamed"
+
+		updated, err := repo.Update(ctx, campaign)
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+
+		if updated.Name != "renamed" || updated.Description != "new description" || updated.GoalAmount != 5000 || updated.Slug != "renamed" {
+			t.Fatalf("update not applied: %+v", updated)
+		}
+
+		if updated.User.Name != "Budi" {
+			t.Fatalf("owner not joined: %+v", updated.User)
+		}
+
+		_, err = repo.Update(ctx, Campaign{ID: 42, Name: "missing"})
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("update missing campaign: got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("update if unchanged", func(t *testing.T) {
+		repo, userRepository := newRepository(t)
+		owner := newOwner(t, userRepository, "budi@example.com")
+		campaign := newCampaign(t, repo, owner.ID, "first")
+
+		campaign.Name = "renamed"
+
+		updated, err := repo.UpdateIfUnchanged(ctx, campaign)
+		if err != nil {
+			t.Fatalf("update unchanged campaign: %v", err)
+		}
+
+		if updated.Name != "renamed" || !updated.UpdatedAt.After(campaign.UpdatedAt) {
+			t.Fatalf("update not applied: %+v", updated)
+		}
+
+		// campaign still carries the UpdatedAt from before the update
+		campaign.Name = "stale"
+
+		_, err = repo.UpdateIfUnchanged(ctx, campaign)
+		if !errors.Is(err, apperror.ErrPreconditionFailed) {
+			t.Fatalf("update stale campaign: got %v, want ErrPreconditionFailed", err)
+		}
+
+		stored, err := repo.GetCampaignByID(ctx, campaign.ID)
+		if err != nil {
+			t.Fatalf("get campaign: %v", err)
+		}
+
+		if stored.Name != "renamed" {
+			t.Fatalf("stale update overwrote the campaign: %+v", stored)
+		}
+	})
+
+	t.Run("images", func(t *testing.T) {
+		repo, userRepository := newRepository(t)
+		owner := newOwner(t, userRepository, "budi@example.com")
+		campaign := newCampaign(t, repo, owner.ID, "first")
+
+		first, err := repo.SaveImage(ctx, CampaignImage{CampaignID: campaign.ID, FileName: "a.png", IsPrimary: true})
+		if err != nil {
+			t.Fatalf("save image: %v", err)
+		}
+
+		if first.ID == 0 || first.CreatedAt.IsZero() {
+			t.Fatalf("image not stored: %+v", first)
+		}
+
+		err = repo.MarkAllImagesAsNonPrimary(ctx, campaign.ID)
+		if err != nil {
+			t.Fatalf("mark non primary: %v", err)
+		}
+
+		_, err = repo.SaveImage(ctx, CampaignImage{CampaignID: campaign.ID, FileName: "b.png", IsPrimary: true})
+		if err != nil {
+			t.Fatalf("save image: %v", err)
+		}
+
+		images, err := repo.FindCampaignImagesByCampaignID(ctx, campaign.ID)
+		if err != nil {
+			t.Fatalf("find images: %v", err)
+		}
+
+		if len(images) != 2 || images[0].FileName != "a.png" || images[0].IsPrimary || images[1].FileName != "b.png" || !images[1].IsPrimary {
+			t.Fatalf("unexpected images: %+v", images)
+		}
+
+		found, err := repo.GetCampaignByID(ctx, campaign.ID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+
+		if len(found.CampaignImages) != 2 {
+			t.Fatalf("images not loaded with campaign: %+v", found.CampaignImages)
+		}
+
+		_, err = repo.SaveImage(ctx, CampaignImage{CampaignID: 42, FileName: "c.png"})
+		if err == nil {
+			t.Fatal("saved an image for a campaign that does not exist")
+		}
+	})
+}
+
+func campaignIDs(campaigns []Campaign) string {
+	ids := []int{}
+	for _, campaign := range campaigns {
+		ids = append(ids, campaign.ID)
+	}
+
+	return fmt.Sprint(ids)
+}
@@ -1,28 +1,39 @@
 package campaign
 
 import (
-	"errors"
+	"chi-app/app/apperror"
+	"chi-app/app/tracing"
+	"chi-app/database"
+	"context"
 	"strings"
+	"time"
 )
 
 type Service interface {
-	GetCampaigns(userID int) ([]Campaign, error)
-	GetCampaignDetail(ID GetCampaignDetailInput) (Campaign, error)
-	CreateCampaign(input CreateCampaignInput) (Campaign, error)
-	Update(inputID GetCampaignDetailInput, inputData CreateCampaignInput) (Campaign, error)
+	GetCampaigns(ctx context.Context, userID int) ([]Campaign, error)
+	GetCreatorCampaigns(ctx context.Context, input GetCreatorCampaignsInput) ([]Campaign, error)
+	GetCreatorSummary(ctx context.Context, userID int) (CreatorSummary, error)
+	GetCampaignDetail(ctx context.Context, ID GetCampaignDetailInput) (Campaign, error)
+	CreateCampaign(ctx context.Context, input CreateCampaignInput) (Campaign, error)
+	Update(ctx context.Context, inputID GetCampaignDetailInput, inputData CreateCampaignInput) (Campaign, error)
+	SaveCampaignImage(ctx context.Context, input CreateCampaignImageInput, fileLocation string, storeFile func() error) (CampaignImage, error)
 }
 
 type service struct {
 	campaignRepository Repository
+	transactor         database.Transactor
 }
 
-func NewCampaignService(campaignRepository Repository) Service {
-	return &service{campaignRepository}
+func NewCampaignService(campaignRepository Repository, transactor database.Transactor) Service {
+	return &service{campaignRepository, transactor}
 }
 
-func (s *service) GetCampaigns(userID int) ([]Campaign, error) {
+func (s *service) GetCampaigns(ctx context.Context, userID int) ([]Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Service.GetCampaigns")
+	defer span.End()
+
 	if userID != 0 {
-		campaigns, err := s.campaignRepository.GetCampaignsByUserID(userID)
+		campaigns, err := s.campaignRepository.GetCampaignsByUserID(ctx, userID)
 		if err != nil {
 			return campaigns, err
 		}
@@ -30,7 +41,21 @@ func (s *service) GetCampaigns(userID int) ([]Campaign, error) {
 		return campaigns, nil
 	}
 
-	campaigns, err := s.campaignRepository.GetCampaigns()
+	campaigns, err := s.campaignRepository.GetCampaigns(ctx)
+	if err != nil {
+		return campaigns, err
+	}
+
+	return campaigns, nil
+}
+
+func (s *service) GetCreatorCampaigns(ctx context.Context, input GetCreatorCampaignsInput) ([]Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Service.GetCreatorCampaigns")
+	defer span.End()
+
+	offset := (input.Page - 1) * input.PerPage
+
+	campaigns, err := s.campaignRepository.GetCampaignsByUserIDPaginated(ctx, input.UserID, input.PerPage, offset)
 	if err != nil {
 		return campaigns, err
 	}
@@ -38,8 +63,23 @@ func (s *service) GetCampaigns(userID int) ([]Campaign, error) {
 	return campaigns, nil
 }
 
-func (s *service) GetCampaignDetail(input GetCampaignDetailInput) (Campaign, error) {
-	campaign, err := s.campaignRepository.GetCampaignByID(input.ID)
+func (s *service) GetCreatorSummary(ctx context.Context, userID int) (CreatorSummary, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Service.GetCreatorSummary")
+	defer span.End()
+
+	summary, err := s.campaignRepository.GetCreatorSummary(ctx, userID)
+	if err != nil {
+		return summary, err
+	}
+
+	return summary, nil
+}
+
+func (s *service) GetCampaignDetail(ctx context.Context, input GetCampaignDetailInput) (Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Service.GetCampaignDetail")
+	defer span.End()
+
+	campaign, err := s.campaignRepository.GetCampaignByID(ctx, input.ID)
 	if err != nil {
 		return campaign, err
 	}
@@ -47,7 +87,10 @@ func (s *service) GetCampaignDetail(input GetCampaignDetailInput) (Campaign, err
 	return campaign, nil
 }
 
-func (s *service) CreateCampaign(input CreateCampaignInput) (Campaign, error) {
+func (s *service) CreateCampaign(ctx context.Context, input CreateCampaignInput) (Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Service.CreateCampaign")
+	defer span.End()
+
 	campaign := Campaign{}
 	campaign.Name = input.Name
 	campaign.ShortDescription = input.ShortDescription
@@ -59,7 +102,7 @@ func (s *service) CreateCampaign(input CreateCampaignInput) (Campaign, error) {
 	slug := strings.ToLower(strings.Join(strings.Split(campaign.Name, " "), "-"))
 	campaign.Slug = slug
 
-	newCampaign, err := s.campaignRepository.Save(campaign)
+	newCampaign, err := s.campaignRepository.Save(ctx, campaign)
 	if err != nil {
 		return newCampaign, err
 	}
@@ -67,14 +110,21 @@ func (s *service) CreateCampaign(input CreateCampaignInput) (Campaign, error) {
 	return newCampaign, nil
 }
 
-func (s *service) Update(inputID GetCampaignDetailInput, inputData CreateCampaignInput) (Campaign, error) {
-	campaign, err := s.campaignRepository.GetCampaignByID(inputID.ID)
+func (s *service) Update(ctx context.Context, inputID GetCampaignDetailInput, inputData CreateCampaignInput) (Campaign, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Service.Update")
+	defer span.End()
+
+	campaign, err := s.campaignRepository.GetCampaignByID(ctx, inputID.ID)
 	if err != nil {
 		return campaign, err
 	}
 
 	if campaign.UserID != inputData.User.ID {
-		return campaign, errors.New("not an owner of the campaign")
+		return campaign, apperror.Forbidden("not an owner of the campaign")
+	}
+
+	if inputData.ExpectedVersions != nil && !isVersion(campaign, inputData.ExpectedVersions) {
+		return campaign, apperror.PreconditionFailed("campaign has been changed since it was read")
 	}
 
 	campaign.Name = inputData.Name
@@ -86,10 +136,78 @@ func (s *service) Update(inputID GetCampaignDetailInput, inputData CreateCampaig
 	slug := strings.ToLower(strings.Join(strings.Split(campaign.Name, " "), "-"))
 	campaign.Slug = slug
 
-	updatedCampaign, err := s.campaignRepository.Update(campaign)
+	update := s.campaignRepository.Update
+	if inputData.ExpectedVersions != nil {
+		update = s.campaignRepository.UpdateIfUnchanged
+	}
+
+	updatedCampaign, err := update(ctx, campaign)
 	if err != nil {
 		return updatedCampaign, err
 	}
 
 	return updatedCampaign, nil
 }
+
+// SaveCampaignImage calls storeFile once the user is known to own the
+// campaign, and records the image only after the file is stored, so an
+// image row never points at a file that was not written.
+func (s *service) SaveCampaignImage(ctx context.Context, input CreateCampaignImageInput, fileLocation string, storeFile func() error) (CampaignImage, error) {
+	ctx, span := tracing.Start(ctx, "campaign.Service.SaveCampaignImage")
+	defer span.End()
+
+	campaignImage := CampaignImage{}
+
+	campaign, err := s.campaignRepository.GetCampaignByID(ctx, input.CampaignID)
+	if err != nil {
+		return campaignImage, err
+	}
+
+	if campaign.UserID != input.User.ID {
+		return campaignImage, apperror.Forbidden("not an owner of the campaign")
+	}
+
+	err = storeFile()
+	if err != nil {
+		return campaignImage, err
+	}
+
+	campaignImage.CampaignID = input.CampaignID
+	campaignImage.FileName = fileLocation
+	campaignImage.IsPrimary = input.IsPrimary
+
+	// a campaign has at most one primary image, so unsetting the old one
+	// and saving the new one must succeed or fail together
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		if campaignImage.IsPrimary {
+			err := s.campaignRepository.MarkAllImagesAsNonPrimary(ctx, campaignImage.CampaignID)
+			if err != nil {
+				return err
+			}
+		}
+
+		newCampaignImage, err := s.campaignRepository.SaveImage(ctx, campaignImage)
+		if err != nil {
+			return err
+		}
+
+		campaignImage = newCampaignImage
+		return nil
+	})
+	if err != nil {
+		return campaignImage, err
+	}
+
+	return campaignImage, nil
+}
+
+// isVersion reports whether campaign is still at one of versions.
+func isVersion(campaign Campaign, versions []time.Time) bool {
+	for _, version := range versions {
+		if campaign.LastModified().Equal(version) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,69 @@
+package campaign
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/app/user"
+	"chi-app/database"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSaveCampaignImageStoresFileFirst(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.NewSQLite(t)
+	userRepository := user.NewUserRepository(db)
+	repo := NewCampaignRepository(db)
+	service := NewCampaignService(repo, database.NewTxManager(db))
+
+	owner, err := userRepository.Save(ctx, user.User{Name: "Budi", Email: "budi@example.com", Role: "user"})
+	if err != nil {
+		t.Fatalf("save owner: %v", err)
+	}
+
+	stranger, err := userRepository.Save(ctx, user.User{Name: "Sari", Email: "sari@example.com", Role: "user"})
+	if err != nil {
+		t.Fatalf("save stranger: %v", err)
+	}
+
+	campaign, err := repo.Save(ctx, Campaign{UserID: owner.ID, Name: "first", ShortDescription: "short", Description: "description", Perks: "perks", GoalAmount: 1000, Slug: "first"})
+	if err != nil {
+		t.Fatalf("save campaign: %v", err)
+	}
+
+	stored := 0
+	storeFile := func() error {
+		stored++
+		return nil
+	}
+
+	_, err = service.SaveCampaignImage(ctx, CreateCampaignImageInput{CampaignID: campaign.ID, IsPrimary: true, User: owner}, "first.png", storeFile)
+	if err != nil {
+		t.Fatalf("save first image: %v", err)
+	}
+
+	// no file is written for a campaign of somebody else
+	_, err = service.SaveCampaignImage(ctx, CreateCampaignImageInput{CampaignID: campaign.ID, IsPrimary: true, User: stranger}, "stranger.png", storeFile)
+	if !errors.Is(err, apperror.ErrForbidden) || stored != 1 {
+		t.Fatalf("save for a stranger: got %v with %d files stored, want ErrForbidden and 1", err, stored)
+	}
+
+	// a file that could not be written leaves the primary image alone
+	failure := errors.New("disk full")
+	_, err = service.SaveCampaignImage(ctx, CreateCampaignImageInput{CampaignID: campaign.ID, IsPrimary: true, User: owner}, "second.png", func() error {
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("save with a failing file: got %v, want the file error", err)
+	}
+
+	images, err := repo.FindCampaignImagesByCampaignID(ctx, campaign.ID)
+	if err != nil {
+		t.Fatalf("find images: %v", err)
+	}
+
+	if len(images) != 1 || images[0].FileName != "first.png" || !images[0].IsPrimary {
+		t.Fatalf("unexpected images: %+v", images)
+	}
+}
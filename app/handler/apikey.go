@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"chi-app/app/apikey"
+	"chi-app/app/helper"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"net/http"
+)
+
+type apiKeyHandler struct {
+	apiKeyService apikey.Service
+}
+
+func NewAPIKeyHandler(apiKeyService apikey.Service) *apiKeyHandler {
+	return &apiKeyHandler{apiKeyService}
+}
+
+func (h *apiKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.CreateAPIKey")
+	defer span.End()
+
+	input := apikey.CreateAPIKeyInput{}
+
+	err := helper.Bind(r, &input)
+	if err != nil {
+		respondError(w, r, "Failed to create api key", err)
+		return
+	}
+
+	input.User = r.Context().Value(key.CtxKeyAuth{}).(user.User)
+
+	newAPIKey, plainKey, err := h.apiKeyService.CreateAPIKey(r.Context(), input)
+	if err != nil {
+		respondError(w, r, "Failed to create api key", err)
+		return
+	}
+
+	formatter := apikey.FormatCreatedAPIKey(newAPIKey, plainKey)
+	response := helper.APIResponse("API key has been created, it will not be shown again", http.StatusCreated, "success", formatter)
+	helper.JSON(w, r, response, http.StatusCreated)
+}
+
+func (h *apiKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.GetAPIKeys")
+	defer span.End()
+
+	userCtx := r.Context().Value(key.CtxKeyAuth{}).(user.User)
+
+	apiKeys, err := h.apiKeyService.GetAPIKeys(r.Context(), userCtx.ID)
+	if err != nil {
+		respondError(w, r, "Failed to get api keys", err)
+		return
+	}
+
+	formatter := apikey.FormatAPIKeys(apiKeys)
+	response := helper.APIResponse("List of api keys", http.StatusOK, "success", formatter)
+	helper.JSON(w, r, response, http.StatusOK)
+}
+
+func (h *apiKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.RevokeAPIKey")
+	defer span.End()
+
+	input := apikey.RevokeAPIKeyInput{}
+
+	err := helper.Bind(r, &input)
+	if err != nil {
+		respondError(w, r, "Failed to revoke api key", err)
+		return
+	}
+
+	input.User = r.Context().Value(key.CtxKeyAuth{}).(user.User)
+
+	revokedAPIKey, err := h.apiKeyService.RevokeAPIKey(r.Context(), input)
+	if err != nil {
+		respondError(w, r, "Failed to revoke api key", err)
+		return
+	}
+
+	formatter := apikey.FormatAPIKey(revokedAPIKey)
+	response := helper.APIResponse("API key has been revoked", http.StatusOK, "success", formatter)
+	helper.JSON(w, r, response, http.StatusOK)
+}
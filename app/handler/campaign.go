@@ -1,17 +1,21 @@
 package handler
 
 import (
+	"chi-app/app/apperror"
 	"chi-app/app/campaign"
 	"chi-app/app/helper"
 	"chi-app/app/key"
 	"chi-app/app/user"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
-
-	"github.com/go-chi/chi/v5"
-	"github.com/go-playground/validator/v10"
+	"strings"
+	"time"
 )
 
 type campaignHandler struct {
@@ -23,141 +27,250 @@ func NewCampaignHandler(campaignService campaign.Service) *campaignHandler {
 }
 
 func (h *campaignHandler) GetCampaigns(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.GetCampaigns")
+	defer span.End()
+
 	userID, _ := strconv.Atoi(r.URL.Query().Get("user_id"))
 
-	campaigns, err := h.campaignService.GetCampaigns(userID)
+	campaigns, err := h.campaignService.GetCampaigns(r.Context(), userID)
 	if err != nil {
-		response := helper.APIResponse("Failed to get campaigns", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed to get campaigns", err)
+		return
+	}
+
+	if helper.NotModified(w, r, campaignsETag(campaigns), campaignsLastModified(campaigns)) {
 		return
 	}
 
 	formatter := campaign.FormatCampaigns(campaigns)
 	response := helper.APIResponse("List of campaigns", http.StatusOK, "success", formatter)
-	helper.JSON(w, response, http.StatusOK)
+	helper.JSON(w, r, response, http.StatusOK)
 }
 
 func (h *campaignHandler) GetCampaignDetail(w http.ResponseWriter, r *http.Request) {
-	campaignID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	r, span := startSpan(r, "handler.GetCampaignDetail")
+	defer span.End()
+
+	input := campaign.GetCampaignDetailInput{}
+
+	err := helper.Bind(r, &input)
 	if err != nil {
-		response := helper.APIResponse("Failed to get detail campaign", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed to get detail campaign", err)
 		return
 	}
 
-	input := campaign.GetCampaignDetailInput{}
-	input.ID = campaignID
-
-	detailCampaign, err := h.campaignService.GetCampaignDetail(input)
+	detailCampaign, err := h.campaignService.GetCampaignDetail(r.Context(), input)
 	if err != nil {
-		response := helper.APIResponse("Failed to get campaigns", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed to get campaigns", err)
+		return
+	}
+
+	if helper.NotModified(w, r, detailCampaign.ETag(), detailCampaign.LastModified()) {
 		return
 	}
 
 	formatter := campaign.FormatCampaignDetail(detailCampaign)
 	response := helper.APIResponse("Detail Campaign", http.StatusOK, "success", formatter)
-	helper.JSON(w, response, http.StatusOK)
+	helper.JSON(w, r, response, http.StatusOK)
 }
 
 func (h *campaignHandler) CreateCampaign(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		data := "Content Type must be application/json"
-		response := helper.APIResponse("Failed to create campaign", http.StatusBadRequest, "error", data)
-		helper.JSON(w, response, http.StatusBadRequest)
-		return
-	}
+	r, span := startSpan(r, "handler.CreateCampaign")
+	defer span.End()
 
-	v := validator.New()
 	input := campaign.CreateCampaignInput{}
 
-	err := json.NewDecoder(r.Body).Decode(&input)
+	err := helper.Bind(r, &input)
 	if err != nil {
-		fmt.Println("Error when parsing")
-		response := helper.APIResponse("Failed to create campaign", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
-		return
-	}
-
-	err = v.Struct(input)
-	if err != nil {
-		var errors []string
-		for _, e := range err.(validator.ValidationErrors) {
-			errors = append(errors, e.Error())
-		}
-
-		response := helper.APIResponse("Failed to create campaign", http.StatusUnprocessableEntity, "error", errors)
-		helper.JSON(w, response, http.StatusUnprocessableEntity)
+		respondError(w, r, "Failed to create campaign", err)
 		return
 	}
 
 	userCtx := r.Context().Value(key.CtxKeyAuth{}).(user.User)
 	input.User = userCtx
 
-	newCampaign, err := h.campaignService.CreateCampaign(input)
+	newCampaign, err := h.campaignService.CreateCampaign(r.Context(), input)
 	if err != nil {
-		response := helper.APIResponse("Failed to create campaign", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed to create campaign", err)
 		return
 	}
 
 	formatter := campaign.FormatCampaign(newCampaign)
 	response := helper.APIResponse("Success to create campaign", http.StatusCreated, "success", formatter)
-	helper.JSON(w, response, http.StatusCreated)
+	helper.JSON(w, r, response, http.StatusCreated)
 }
 
 func (h *campaignHandler) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		data := "Content Type must be application/json"
-		response := helper.APIResponse("Failed to update campaign", http.StatusBadRequest, "error", data)
-		helper.JSON(w, response, http.StatusBadRequest)
+	r, span := startSpan(r, "handler.UpdateCampaign")
+	defer span.End()
+
+	inputID := campaign.GetCampaignDetailInput{}
+
+	err := helper.Bind(r, &inputID)
+	if err != nil {
+		respondError(w, r, "Failed to update campaign", err)
 		return
 	}
 
-	campaignID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	inputData := campaign.CreateCampaignInput{}
+
+	err = helper.Bind(r, &inputData)
 	if err != nil {
-		response := helper.APIResponse("Failed to update campaign", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed to update campaign", err)
 		return
 	}
 
-	inputID := campaign.GetCampaignDetailInput{}
-	inputID.ID = campaignID
+	// get data user from context
+	userCtx := r.Context().Value(key.CtxKeyAuth{}).(user.User)
+	inputData.User = userCtx
 
-	v := validator.New()
-	inputData := campaign.CreateCampaignInput{}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		versions, ok := ifMatchVersions(ifMatch)
+		if !ok {
+			respondError(w, r, "Failed to update campaign", apperror.PreconditionFailed("campaign has been changed since it was read"))
+			return
+		}
 
-	err = json.NewDecoder(r.Body).Decode(&inputData)
+		inputData.ExpectedVersions = versions
+	}
+
+	updatedCampaign, err := h.campaignService.Update(r.Context(), inputID, inputData)
 	if err != nil {
-		response := helper.APIResponse("Failed update campaign", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed to update campaign", err)
 		return
 	}
 
-	err = v.Struct(&inputData)
+	// the response is the detail the validators describe, an editor can
+	// send the ETag back with its next update
+	w.Header().Set("ETag", helper.RepresentationETag(r, updatedCampaign.ETag()))
+	w.Header().Set("Last-Modified", updatedCampaign.LastModified().UTC().Format(http.TimeFormat))
+
+	formatter := campaign.FormatCampaignDetail(updatedCampaign)
+	response := helper.APIResponse("Success to update campaign", http.StatusOK, "success", formatter)
+	helper.JSON(w, r, response, http.StatusOK)
+}
+
+func (h *campaignHandler) UploadCampaignImage(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.UploadCampaignImage")
+	defer span.End()
+
+	input := campaign.CreateCampaignImageInput{}
+
+	defer helper.RemoveMultipartFiles(r)
+
+	err := helper.Bind(r, &input, helper.MaxBodySize(maxUploadSize))
 	if err != nil {
-		var errors []string
-		for _, e := range err.(validator.ValidationErrors) {
-			errors = append(errors, e.Error())
-		}
+		respondError(w, r, "Failed to upload campaign image", err)
+		return
+	}
 
-		response := helper.APIResponse("Failed to update campaign", http.StatusUnprocessableEntity, "error", errors)
-		helper.JSON(w, response, http.StatusUnprocessableEntity)
+	uploadedFile, err := input.File.Open()
+	if err != nil {
+		respondError(w, r, "Failed to upload campaign image", err)
+		return
+	}
+
+	defer uploadedFile.Close()
+
+	dir, err := os.Getwd()
+	if err != nil {
+		respondInternalError(w, r, "Failed to upload campaign image", err)
 		return
 	}
 
 	// get data user from context
 	userCtx := r.Context().Value(key.CtxKeyAuth{}).(user.User)
-	inputData.User = userCtx
+	input.User = userCtx
+
+	filename := fmt.Sprintf("%d-%d-%s", userCtx.ID, input.CampaignID, filepath.Base(input.File.Filename))
+	fileLocation := filepath.Join(dir, "images", filename)
+
+	// the file is written only for the owner of the campaign and before
+	// the image row, which may make it the primary image
+	var fileErr error
+	_, err = h.campaignService.SaveCampaignImage(r.Context(), input, filename, func() error {
+		fileErr = writeFile(fileLocation, uploadedFile)
+		return fileErr
+	})
+	if fileErr != nil {
+		respondInternalError(w, r, "Failed to upload campaign image", fileErr)
+		return
+	}
 
-	updatedCampaign, err := h.campaignService.Update(inputID, inputData)
 	if err != nil {
-		response := helper.APIResponse("Failed to update campaign", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed to upload campaign image", err)
 		return
 	}
 
-	formatter := campaign.FormatCampaign(updatedCampaign)
-	response := helper.APIResponse("Success to update campaign", http.StatusCreated, "success", formatter)
-	helper.JSON(w, response, http.StatusCreated)
+	data := map[string]interface{}{
+		"is_uploaded": true,
+	}
+
+	response := helper.APIResponse("Campaign image successfully uploaded", http.StatusCreated, "success", data)
+	helper.JSON(w, r, response, http.StatusCreated)
+}
+
+func writeFile(fileLocation string, content io.Reader) error {
+	targetFile, err := os.OpenFile(fileLocation, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(targetFile, content)
+	if err != nil {
+		targetFile.Close()
+		return err
+	}
+
+	return targetFile.Close()
+}
+
+// ifMatchVersions reads the campaign versions an If-Match list accepts.
+// "*" only asks for the campaign to exist, the service checks that anyway,
+// and gives nil versions. The campaign tags are weak, so they are compared
+// weakly: a version changes with every write, which is as exact as a
+// strong comparison would be here. ok is false when nothing in the list
+// can match.
+func ifMatchVersions(ifMatch string) (versions []time.Time, ok bool) {
+	for _, etag := range helper.ETags(ifMatch) {
+		if etag == "*" {
+			return nil, true
+		}
+
+		version, parsed := campaign.ParseETag(helper.BaseETag(etag))
+		if parsed {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, len(versions) > 0
+}
+
+// campaignsETag changes whenever a listed campaign or one of its images
+// changes, or a campaign joins or leaves the list.
+func campaignsETag(campaigns []campaign.Campaign) string {
+	ids := make([]string, 0, len(campaigns))
+	for _, c := range campaigns {
+		ids = append(ids, strconv.Itoa(c.ID))
+	}
+
+	version := "0"
+	if lastModified := campaignsLastModified(campaigns); !lastModified.IsZero() {
+		version = strconv.FormatInt(lastModified.UnixNano(), 36)
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(ids, ",")))
+
+	return helper.WeakETag(hex.EncodeToString(hash[:8]) + "-" + version)
+}
+
+func campaignsLastModified(campaigns []campaign.Campaign) time.Time {
+	lastModified := time.Time{}
+	for _, c := range campaigns {
+		if c.LastModified().After(lastModified) {
+			lastModified = c.LastModified()
+		}
+	}
+
+	return lastModified
 }
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"chi-app/app/campaign"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestCampaignConditionalRequests(t *testing.T) {
+	ctx := context.Background()
+	userRepository := user.NewMemoryUserRepository()
+	campaignRepository := campaign.NewMemoryCampaignRepository(userRepository)
+	campaignHandler := NewCampaignHandler(campaign.NewCampaignService(campaignRepository, nil))
+
+	owner, err := userRepository.Save(ctx, user.User{Name: "Budi", Email: "budi@example.com", Role: "user"})
+	if err != nil {
+		t.Fatalf("save owner: %v", err)
+	}
+
+	saved, err := campaignRepository.Save(ctx, campaign.Campaign{UserID: owner.ID, Name: "first", ShortDescription: "short", Description: "description", Perks: "perks", GoalAmount: 1000})
+	if err != nil {
+		t.Fatalf("save campaign: %v", err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/campaigns", campaignHandler.GetCampaigns)
+	r.Get("/campaigns/{id}", campaignHandler.GetCampaignDetail)
+	r.With(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key.CtxKeyAuth{}, owner)))
+		})
+	}).Put("/campaigns/{id}", campaignHandler.UpdateCampaign)
+
+	path := "/campaigns/" + strconv.Itoa(saved.ID)
+
+	serve := func(method string, target string, header string, value string) *httptest.ResponseRecorder {
+		body := `{"name":"renamed","short_description":"short","description":"description","perks":"perks","goal_amount":2000}`
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	for _, target := range []string{path, "/campaigns"} {
+		w := serve(http.MethodGet, target, "", "")
+		etag := w.Header().Get("ETag")
+		lastModified := w.Header().Get("Last-Modified")
+		if w.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || lastModified == "" {
+			t.Fatalf("GET %s: got status %d, ETag %q, Last-Modified %q", target, w.Code, etag, lastModified)
+		}
+
+		if w = serve(http.MethodGet, target, "If-None-Match", `"other", `+etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("GET %s with matching If-None-Match: got status %d, body %q", target, w.Code, w.Body.String())
+		}
+
+		if w = serve(http.MethodGet, target, "If-Modified-Since", lastModified); w.Code != http.StatusNotModified {
+			t.Fatalf("GET %s with current If-Modified-Since: got status %d", target, w.Code)
+		}
+
+		if w = serve(http.MethodGet, target, "If-Modified-Since", saved.UpdatedAt.Add(-time.Hour).Format(http.TimeFormat)); w.Code != http.StatusOK {
+			t.Fatalf("GET %s with old If-Modified-Since: got status %d", target, w.Code)
+		}
+	}
+
+	etag := serve(http.MethodGet, path, "", "").Header().Get("ETag")
+
+	// the owner is not part of the campaign version
+	owner.AvatarFileName = "1-avatar.png"
+	if _, err := userRepository.Update(ctx, owner.ID, owner); err != nil {
+		t.Fatalf("update owner: %v", err)
+	}
+
+	if got := serve(http.MethodGet, path, "", "").Header().Get("ETag"); got != etag {
+		t.Fatalf("ETag after the owner changed: got %q, want %q", got, etag)
+	}
+
+	w := serve(http.MethodPut, path, "If-Match", etag)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Fatalf("PUT with current If-Match: got status %d, ETag %q: %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+
+	// the PUT answers with the detail its ETag describes
+	current := w.Header().Get("ETag")
+	detail := serve(http.MethodGet, path, "", "")
+	if detail.Header().Get("ETag") != current || responseData(t, w) != responseData(t, detail) {
+		t.Fatalf("PUT response %q %s differs from the detail %q %s", current, w.Body.String(), detail.Header().Get("ETag"), detail.Body.String())
+	}
+
+	// the other editor still holds the old tag
+	if w = serve(http.MethodPut, path, "If-Match", etag); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT with stale If-Match: got status %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+
+	// the tags compare weakly, the W/ prefix may be dropped
+	w = serve(http.MethodPut, path, "If-Match", strings.TrimPrefix(current, "W/"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT with If-Match without W/: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	current = w.Header().Get("ETag")
+
+	// any tag of the list may match
+	w = serve(http.MethodPut, path, "If-Match", etag+`, "garbage", `+current)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT with If-Match list: got status %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	if w = serve(http.MethodPut, path, "If-Match", `"garbage"`); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT with unknown If-Match: got status %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+
+	if w = serve(http.MethodPut, path, "If-Match", "*"); w.Code != http.StatusOK {
+		t.Fatalf("PUT with If-Match *: got status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if w = serve(http.MethodGet, path, "If-None-Match", etag); w.Code != http.StatusOK {
+		t.Fatalf("GET with outdated If-None-Match: got status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+// responseData returns the data of an APIResponse body.
+func responseData(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	response := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	return string(response.Data)
+}
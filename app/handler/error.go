@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/app/helper"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// statusClientClosedRequest is the nginx status for a request the client
+// gave up on before the answer was ready.
+const statusClientClosedRequest = 499
+
+// respondError writes the standard error envelope for err. Validation
+// errors from helper.Bind get the per field answer, otherwise the status
+// follows the apperror kind. Errors that are not recognised are failures
+// on our side, they are logged and answered 500 without their message,
+// which may name tables or paths.
+func respondError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	trace.SpanFromContext(r.Context()).RecordError(err)
+
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		respondValidationError(w, r, message, err)
+		return
+	}
+
+	status := errorStatus(r, err)
+
+	var data interface{} = err.Error()
+	switch status {
+	case http.StatusInternalServerError:
+		data = "something went wrong on our side, please try again"
+	case http.StatusGatewayTimeout:
+		data = "the request took too long, please try again"
+	case http.StatusServiceUnavailable:
+		data = "the service is temporarily unavailable, please try again"
+		w.Header().Set("Retry-After", "1")
+	case statusClientClosedRequest:
+		// nobody reads the answer, the cancelled work is not a failure
+		slog.InfoContext(r.Context(), message, slog.Any("error", err))
+		data = "the request was cancelled"
+	}
+
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), message, slog.Any("error", err))
+	}
+
+	helper.Error(w, r, message, status, data, nil)
+}
+
+// RespondError is respondError for middleware in front of the handlers,
+// so a failure answers the same status wherever it surfaces.
+func RespondError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	respondError(w, r, message, err)
+}
+
+// respondInternalError answers 500 for failures the client cannot do
+// anything about. The error is logged, not sent, it may contain paths.
+func respondInternalError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	trace.SpanFromContext(r.Context()).RecordError(err)
+	slog.ErrorContext(r.Context(), message, slog.Any("error", err))
+
+	helper.Error(w, r, message, http.StatusInternalServerError, nil, nil)
+}
+
+// respondValidationError answers 422 with one entry per invalid field.
+func respondValidationError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	helper.Error(w, r, message, http.StatusUnprocessableEntity, nil, helper.FormatValidationErrors(r.Context(), err))
+}
+
+func errorStatus(r *http.Request, err error) int {
+	switch {
+	case errors.Is(err, apperror.ErrBadRequest), errors.Is(err, helper.ErrInvalidRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, apperror.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, apperror.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, apperror.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, apperror.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, apperror.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, helper.ErrUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, helper.ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	// a client that went away fails whatever was running for it, the
+	// request context tells that apart from a failure of ours
+	case errors.Is(err, context.Canceled), errors.Is(r.Context().Err(), context.Canceled):
+		return statusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, sql.ErrConnDone):
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
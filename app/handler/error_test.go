@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"chi-app/app/apperror"
+	"chi-app/app/campaign"
+	"chi-app/app/helper"
+	"chi-app/app/user"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{apperror.NotFound("campaign not found"), http.StatusNotFound},
+		{apperror.Forbidden("not an owner of the campaign"), http.StatusForbidden},
+		{apperror.Conflict("email has already been registered"), http.StatusConflict},
+		{apperror.Validation("invalid two-factor code"), http.StatusUnprocessableEntity},
+		{apperror.PreconditionFailed("campaign has been changed since it was read"), http.StatusPreconditionFailed},
+		{fmt.Errorf("update: %w", apperror.NotFound("campaign not found")), http.StatusNotFound},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{fmt.Errorf("query: %w", context.Canceled), statusClientClosedRequest},
+		{driver.ErrBadConn, http.StatusServiceUnavailable},
+		{apperror.BadRequest("email or password not match"), http.StatusBadRequest},
+		{fmt.Errorf("bind: %w", helper.ErrInvalidRequest), http.StatusBadRequest},
+		{errors.New("something else"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+		if got := errorStatus(r, test.err); got != test.want {
+			t.Errorf("errorStatus(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRespondErrorHidesUnknownErrors(t *testing.T) {
+	w := httptest.NewRecorder()
+	respondError(w, httptest.NewRequest(http.MethodGet, "/", nil), "Failed to get campaigns", errors.New("dial tcp 10.0.0.5:3306: connection refused"))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	if strings.Contains(w.Body.String(), "10.0.0.5") {
+		t.Fatalf("error sent to the client: %s", w.Body.String())
+	}
+}
+
+func TestRespondErrorClientGone(t *testing.T) {
+	buf := &bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(buf, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the driver failed the query in its own words
+	w := httptest.NewRecorder()
+	respondError(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), "Failed to get campaigns", errors.New("pq: canceling statement due to user request"))
+
+	if w.Code != statusClientClosedRequest {
+		t.Fatalf("got status %d, want %d", w.Code, statusClientClosedRequest)
+	}
+
+	if strings.Contains(buf.String(), `"level":"ERROR"`) || !strings.Contains(buf.String(), `"level":"INFO"`) {
+		t.Fatalf("cancelled request not logged at info level: %s", buf.String())
+	}
+}
+
+func TestGetCampaignDetailNotFound(t *testing.T) {
+	campaignRepository := campaign.NewMemoryCampaignRepository(user.NewMemoryUserRepository())
+	campaignHandler := NewCampaignHandler(campaign.NewCampaignService(campaignRepository, nil))
+
+	r := chi.NewRouter()
+	r.Get("/campaigns/{id}", campaignHandler.GetCampaignDetail)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/campaigns/999", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusNotFound, w.Body.String())
+	}
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"chi-app/app/health"
+	"chi-app/app/helper"
+	"chi-app/app/version"
+	"net/http"
+)
+
+type healthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *healthHandler {
+	return &healthHandler{checker}
+}
+
+// Healthz only tells that the process serves requests, dependencies are
+// checked by Readyz.
+func (h *healthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	data := map[string]interface{}{
+		"status": health.StatusOK,
+	}
+
+	response := helper.APIResponse("Service is healthy", http.StatusOK, "success", data)
+	helper.JSON(w, r, response, http.StatusOK)
+}
+
+func (h *healthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Check(r.Context())
+
+	if !report.Ready() {
+		response := helper.APIResponse("Service is not ready", http.StatusServiceUnavailable, "error", report)
+		helper.JSON(w, r, response, http.StatusServiceUnavailable)
+		return
+	}
+
+	response := helper.APIResponse("Service is ready", http.StatusOK, "success", report)
+	helper.JSON(w, r, response, http.StatusOK)
+}
+
+func (h *healthHandler) Version(w http.ResponseWriter, r *http.Request) {
+	response := helper.APIResponse("Version", http.StatusOK, "success", version.Get())
+	helper.JSON(w, r, response, http.StatusOK)
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+type mediaHandler struct {
+	files http.Handler
+}
+
+// NewMediaHandler serves the uploaded files in dir. It has to be mounted
+// behind http.StripPrefix of its route.
+func NewMediaHandler(dir string) *mediaHandler {
+	return &mediaHandler{http.FileServer(http.Dir(dir))}
+}
+
+// ServeFile answers 404 for directories, the upload folder is not listed.
+func (h *mediaHandler) ServeFile(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	h.files.ServeHTTP(w, r)
+}
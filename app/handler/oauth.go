@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"chi-app/app/auth"
+	"chi-app/app/helper"
+	"chi-app/app/oidc"
+	"chi-app/app/user"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	oauthStateTTL    = 10 * time.Minute
+	oauthStateCookie = "oauth_state"
+)
+
+type oauthHandler struct {
+	providers   map[string]*oidc.Provider
+	states      oidc.StateStore
+	userService user.Service
+	authService auth.Service
+}
+
+func NewOAuthHandler(providers []*oidc.Provider, states oidc.StateStore, userService user.Service, authService auth.Service) *oauthHandler {
+	providerMap := map[string]*oidc.Provider{}
+	for _, provider := range providers {
+		providerMap[provider.Name()] = provider
+	}
+
+	return &oauthHandler{
+		providers:   providerMap,
+		states:      states,
+		userService: userService,
+		authService: authService,
+	}
+}
+
+func (h *oauthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.Authorize")
+	defer span.End()
+
+	provider, ok := h.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		response := helper.APIResponse("Unknown login provider", http.StatusNotFound, "error", nil)
+		helper.JSON(w, r, response, http.StatusNotFound)
+		return
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		respondInternalError(w, r, "Failed to start login", err)
+		return
+	}
+
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		respondInternalError(w, r, "Failed to start login", err)
+		return
+	}
+
+	codeVerifier, err := oidc.RandomString(48)
+	if err != nil {
+		respondInternalError(w, r, "Failed to start login", err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, oidc.CodeChallenge(codeVerifier))
+	if err != nil {
+		trace.SpanFromContext(r.Context()).RecordError(err)
+		slog.WarnContext(r.Context(), "login provider is unavailable", slog.String("provider", provider.Name()), slog.Any("error", err))
+
+		helper.Error(w, r, "Failed to start login", http.StatusBadGateway, "login provider is unavailable", nil)
+		return
+	}
+
+	authRequest := oidc.AuthRequest{}
+	authRequest.Provider = provider.Name()
+	authRequest.CodeVerifier = codeVerifier
+	authRequest.Nonce = nonce
+	authRequest.ExpiresAt = time.Now().Add(oauthStateTTL)
+
+	err = h.states.Save(r.Context(), state, authRequest)
+	if err != nil {
+		respondInternalError(w, r, "Failed to start login", err)
+		return
+	}
+
+	// the callback has to come back to the browser that started the
+	// login, otherwise a callback URL of somebody else's login would sign
+	// the victim in to that account
+	http.SetCookie(w, stateCookie(provider, state, oauthStateTTL))
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h *oauthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.Callback")
+	defer span.End()
+
+	provider, ok := h.providers[chi.URLParam(r, "provider")]
+	if !ok {
+		response := helper.APIResponse("Unknown login provider", http.StatusNotFound, "error", nil)
+		helper.JSON(w, r, response, http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		response := helper.APIResponse("Failed login user", http.StatusUnauthorized, "error", providerError)
+		helper.JSON(w, r, response, http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	http.SetCookie(w, stateCookie(provider, "", -1))
+
+	state := query.Get("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		response := helper.APIResponse("Failed login user", http.StatusBadRequest, "error", "invalid or expired state")
+		helper.JSON(w, r, response, http.StatusBadRequest)
+		return
+	}
+
+	authRequest, ok, err := h.states.Take(r.Context(), state)
+	if err != nil {
+		respondInternalError(w, r, "Failed login user", err)
+		return
+	}
+
+	if !ok || authRequest.Provider != provider.Name() {
+		response := helper.APIResponse("Failed login user", http.StatusBadRequest, "error", "invalid or expired state")
+		helper.JSON(w, r, response, http.StatusBadRequest)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), authRequest.CodeVerifier, authRequest.Nonce)
+	if err != nil {
+		trace.SpanFromContext(r.Context()).RecordError(err)
+		slog.WarnContext(r.Context(), "login provider refused the code", slog.String("provider", provider.Name()), slog.Any("error", err))
+
+		helper.Error(w, r, "Failed login user", http.StatusUnauthorized, "login with the provider failed", nil)
+		return
+	}
+
+	input := user.SocialLoginInput{}
+	input.Provider = provider.Name()
+	input.Subject = claims.Subject
+	input.Email = claims.Email
+	input.EmailVerified = claims.EmailVerified
+	input.Name = claims.Name
+
+	err = helper.Validate(input)
+	if err != nil {
+		helper.Error(w, r, "Failed login user", http.StatusUnprocessableEntity, "provider did not return a valid email address", nil)
+		return
+	}
+
+	loggedInUser, err := h.userService.LoginWithIdentity(r.Context(), input)
+	if err != nil {
+		respondError(w, r, "Failed login user", err)
+		return
+	}
+
+	respondWithSession(w, r, h.authService, loggedInUser, "Failed login user")
+}
+
+// stateCookie holds the state of a login for the callback of provider
+// only. A negative maxAge deletes it.
+func stateCookie(provider *oidc.Provider, state string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if callback, err := url.Parse(provider.RedirectURL()); err == nil && callback.Path != "" {
+		cookie.Path = callback.Path
+		cookie.Secure = callback.Scheme == "https"
+	}
+
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
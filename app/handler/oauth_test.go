@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"chi-app/app/oidc"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestOAuthStateIsBoundToTheBrowser(t *testing.T) {
+	issuer := http.NewServeMux()
+	server := httptest.NewServer(issuer)
+	defer server.Close()
+
+	issuer.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Discovery{
+			Issuer:                server.URL,
+			AuthorizationEndpoint: server.URL + "/authorize",
+			TokenEndpoint:         server.URL + "/token",
+			JWKSURI:               server.URL + "/jwks",
+		})
+	})
+
+	issuer.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_grant: code was issued to client 42 on shard db-7", http.StatusBadRequest)
+	})
+
+	provider := oidc.NewProvider(oidc.Config{Name: "test", DiscoveryURL: server.URL + "/.well-known/openid-configuration", ClientID: "client-id", RedirectURL: "https://app.example.com/api/v1/oauth/test/callback"}, server.Client())
+	oauthHandler := NewOAuthHandler([]*oidc.Provider{provider}, oidc.NewMemoryStateStore(), nil, nil)
+
+	r := chi.NewRouter()
+	r.Get("/oauth/{provider}/authorize", oauthHandler.Authorize)
+	r.Get("/oauth/{provider}/callback", oauthHandler.Callback)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth/test/authorize", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("authorize: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize location: %v", err)
+	}
+
+	state := location.Query().Get("state")
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("authorize: got %d cookies, want 1", len(cookies))
+	}
+
+	cookie := cookies[0]
+	if cookie.Value != state || !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/api/v1/oauth/test/callback" {
+		t.Fatalf("unexpected state cookie: %+v", cookie)
+	}
+
+	callback := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/oauth/test/callback?code=code&state="+url.QueryEscape(state), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	// a callback URL handed to another browser does not log it in
+	if w := callback(nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("callback without the cookie: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	if w := callback(&http.Cookie{Name: cookie.Name, Value: "other"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("callback with another state cookie: got status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w = callback(cookie)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("callback with a refused code: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if strings.Contains(w.Body.String(), "shard") {
+		t.Fatalf("provider error sent to the client: %s", w.Body.String())
+	}
+
+	cleared := w.Result().Cookies()
+	if len(cleared) != 1 || cleared[0].Name != cookie.Name || cleared[0].MaxAge >= 0 {
+		t.Fatalf("state cookie not cleared: %+v", cleared)
+	}
+}
@@ -0,0 +1,15 @@
+package handler
+
+import (
+	"chi-app/app/tracing"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startSpan opens the handler span under the server span of the tracing
+// middleware and returns the request carrying it.
+func startSpan(r *http.Request, name string) (*http.Request, trace.Span) {
+	ctx, span := tracing.Start(r.Context(), name)
+	return r.WithContext(ctx), span
+}
@@ -2,116 +2,84 @@ package handler
 
 import (
 	"chi-app/app/auth"
+	"chi-app/app/campaign"
 	"chi-app/app/helper"
 	"chi-app/app/key"
+	"chi-app/app/totp"
 	"chi-app/app/user"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
-
-	"github.com/go-playground/validator/v10"
+	"strconv"
 )
 
+// maxUploadSize bounds avatar and campaign image uploads.
+const maxUploadSize = 5 << 20
+
 type userHandler struct {
-	userService user.Service
-	authService auth.Service
+	userService     user.Service
+	authService     auth.Service
+	campaignService campaign.Service
 }
 
-func NewUserHandler(userService user.Service, authService auth.Service) *userHandler {
+func NewUserHandler(userService user.Service, authService auth.Service, campaignService campaign.Service) *userHandler {
 	return &userHandler{
-		userService: userService,
-		authService: authService,
+		userService:     userService,
+		authService:     authService,
+		campaignService: campaignService,
 	}
 }
 
 func (h *userHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		data := "Content Type must be application/json"
-		response := helper.APIResponse("Failed register user", http.StatusBadRequest, "error", data)
-		helper.JSON(w, response, http.StatusBadRequest)
-		return
-	}
+	r, span := startSpan(r, "handler.RegisterUser")
+	defer span.End()
 
 	// https://medium.com/@apzuk3/input-validation-in-golang-bc24cdec1835
 	// reference validate struct fields
-	v := validator.New()
 	input := user.RegisterUserInput{}
 
-	err := json.NewDecoder(r.Body).Decode(&input)
-	if err != nil {
-		response := helper.APIResponse("Failed register user", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
-		return
-	}
-
-	err = v.Struct(input)
+	err := helper.Bind(r, &input)
 	if err != nil {
-		var errors []string
-		for _, e := range err.(validator.ValidationErrors) {
-			errors = append(errors, e.Error())
-		}
-
-		response := helper.APIResponse("Failed register user", http.StatusUnprocessableEntity, "error", errors)
-		helper.JSON(w, response, http.StatusUnprocessableEntity)
+		respondError(w, r, "Failed register user", err)
 		return
 	}
 
-	newUser, err := h.userService.RegisterUser(input)
+	newUser, err := h.userService.RegisterUser(r.Context(), input)
 	if err != nil {
-		response := helper.APIResponse("Failed register user", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed register user", err)
 		return
 	}
 
 	token, err := h.authService.GenerateToken(newUser.ID)
 	if err != nil {
-		response := helper.APIResponse("Failed register user", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed register user", err)
 		return
 	}
 
 	formatter := user.FormatUser(newUser, token)
 	response := helper.APIResponse("Account has been created", http.StatusCreated, "success", formatter)
-	helper.JSON(w, response, http.StatusCreated)
+	helper.JSON(w, r, response, http.StatusCreated)
 }
 
 func (h *userHandler) CheckEmailAvailable(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		data := "Content Type must be application/json"
-		response := helper.APIResponse("Failed check email", http.StatusBadRequest, "error", data)
-		helper.JSON(w, response, http.StatusBadRequest)
-		return
-	}
+	r, span := startSpan(r, "handler.CheckEmailAvailable")
+	defer span.End()
 
-	v := validator.New()
 	input := user.CheckEmailAvailableInput{}
 
-	err := json.NewDecoder(r.Body).Decode(&input)
+	err := helper.Bind(r, &input)
 	if err != nil {
-		response := helper.APIResponse("Failed check email", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed check email", err)
 		return
 	}
 
-	err = v.Struct(input)
+	isAvailable, err := h.userService.IsEmailAvailable(r.Context(), input)
 	if err != nil {
-		var errors []string
-		for _, e := range err.(validator.ValidationErrors) {
-			errors = append(errors, e.Error())
-		}
-
-		response := helper.APIResponse("Failed check email", http.StatusUnprocessableEntity, "error", errors)
-		helper.JSON(w, response, http.StatusUnprocessableEntity)
-		return
-	}
-
-	isAvailable, err := h.userService.IsEmailAvailable(input)
-	if err != nil {
-		response := helper.APIResponse("Failed check email", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed check email", err)
 		return
 	}
 
@@ -125,69 +93,189 @@ func (h *userHandler) CheckEmailAvailable(w http.ResponseWriter, r *http.Request
 	}
 
 	response := helper.APIResponse("Success check available email", http.StatusOK, "success", data)
-	helper.JSON(w, response, http.StatusOK)
+	helper.JSON(w, r, response, http.StatusOK)
 }
 
 func (h *userHandler) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		data := "Content Type must be application/json"
-		response := helper.APIResponse("Failed login user", http.StatusBadRequest, "error", data)
-		helper.JSON(w, response, http.StatusBadRequest)
-		return
-	}
+	r, span := startSpan(r, "handler.Login")
+	defer span.End()
 
-	v := validator.New()
 	input := user.LoginUserInput{}
 
-	err := json.NewDecoder(r.Body).Decode(&input)
+	err := helper.Bind(r, &input)
 	if err != nil {
-		response := helper.APIResponse("Failed login user", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed login user", err)
+		return
+	}
+
+	input.IPAddress = clientIP(r)
+
+	loggedInUser, err := h.userService.LoginUser(r.Context(), input)
+	var lockedErr *user.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		retryAfter := int(math.Ceil(lockedErr.RetryAfter().Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+		helper.Error(w, r, "Failed login user", http.StatusTooManyRequests, err.Error(), nil)
 		return
 	}
 
-	err = v.Struct(input)
 	if err != nil {
-		var errors []string
-		for _, e := range err.(validator.ValidationErrors) {
-			errors = append(errors, e.Error())
+		respondError(w, r, "Failed login user", err)
+		return
+	}
+
+	respondWithSession(w, r, h.authService, loggedInUser, "Failed login user")
+}
+
+// respondWithSession finishes a successful first login step. Accounts with
+// two-factor authentication only get a challenge token for
+// POST /sessions/2fa instead of an access token.
+func respondWithSession(w http.ResponseWriter, r *http.Request, authService auth.Service, loggedInUser user.User, failMessage string) {
+	if loggedInUser.TOTPEnabled {
+		challengeToken, err := authService.GenerateChallengeToken(loggedInUser.ID)
+		if err != nil {
+			respondError(w, r, failMessage, err)
+			return
 		}
 
-		response := helper.APIResponse("Failed login user", http.StatusUnprocessableEntity, "error", errors)
-		helper.JSON(w, response, http.StatusUnprocessableEntity)
+		formatter := user.FormatTwoFactorChallenge(challengeToken, int(auth.ChallengeTokenTTL.Seconds()))
+		response := helper.APIResponse("Two-factor authentication required", http.StatusOK, "success", formatter)
+		helper.JSON(w, r, response, http.StatusOK)
 		return
 	}
 
-	loggedInUser, err := h.userService.LoginUser(input)
+	token, err := authService.GenerateToken(loggedInUser.ID)
 	if err != nil {
-		response := helper.APIResponse("Failed login user", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, failMessage, err)
+		return
+	}
+
+	formatter := user.FormatUser(loggedInUser, token)
+	response := helper.APIResponse("Login Successfully", http.StatusCreated, "success", formatter)
+	helper.JSON(w, r, response, http.StatusCreated)
+}
+
+func (h *userHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.VerifyTwoFactor")
+	defer span.End()
+
+	input := user.VerifyTwoFactorInput{}
+
+	err := helper.Bind(r, &input)
+	if err != nil {
+		respondError(w, r, "Failed login user", err)
+		return
+	}
+
+	challenge, err := h.authService.ValidateChallengeToken(input.ChallengeToken)
+	if err != nil {
+		response := helper.APIResponse("Unauthorized", http.StatusUnauthorized, "error", nil)
+		helper.JSON(w, r, response, http.StatusUnauthorized)
+		return
+	}
+
+	input.UserID = challenge.UserID
+	input.ChallengeID = challenge.ID
+	input.ChallengeExpiresAt = challenge.ExpiresAt
+	input.IPAddress = clientIP(r)
+
+	loggedInUser, err := h.userService.VerifyTwoFactor(r.Context(), input)
+	var lockedErr *user.LoginLockedError
+	if errors.As(err, &lockedErr) {
+		retryAfter := int(math.Ceil(lockedErr.RetryAfter().Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+		helper.Error(w, r, "Failed login user", http.StatusTooManyRequests, err.Error(), nil)
+		return
+	}
+
+	if err != nil {
+		respondError(w, r, "Failed login user", err)
 		return
 	}
 
 	token, err := h.authService.GenerateToken(loggedInUser.ID)
 	if err != nil {
-		response := helper.APIResponse("Failed login user", http.StatusBadRequest, "error", err.Error())
-		helper.JSON(w, response, http.StatusBadRequest)
+		respondError(w, r, "Failed login user", err)
 		return
 	}
 
 	formatter := user.FormatUser(loggedInUser, token)
 	response := helper.APIResponse("Login Successfully", http.StatusCreated, "success", formatter)
-	helper.JSON(w, response, http.StatusCreated)
+	helper.JSON(w, r, response, http.StatusCreated)
+}
+
+func (h *userHandler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.EnrollTwoFactor")
+	defer span.End()
+
+	userCtx := r.Context().Value(key.CtxKeyAuth{}).(user.User)
+
+	enrollment, err := h.userService.EnrollTwoFactor(r.Context(), userCtx.ID)
+	if err != nil {
+		respondError(w, r, "Failed to enroll two-factor authentication", err)
+		return
+	}
+
+	qrCode, err := totp.QRCodePNG(enrollment.URI, 256)
+	if err != nil {
+		response := helper.APIResponse("Failed to enroll two-factor authentication", http.StatusInternalServerError, "error", err.Error())
+		helper.JSON(w, r, response, http.StatusInternalServerError)
+		return
+	}
+
+	formatter := user.FormatTwoFactorEnrollment(enrollment, qrCode)
+	response := helper.APIResponse("Scan the QR code and confirm with a code", http.StatusCreated, "success", formatter)
+	helper.JSON(w, r, response, http.StatusCreated)
+}
+
+func (h *userHandler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.ConfirmTwoFactor")
+	defer span.End()
+
+	input := user.ConfirmTwoFactorInput{}
+
+	err := helper.Bind(r, &input)
+	if err != nil {
+		respondError(w, r, "Failed to confirm two-factor authentication", err)
+		return
+	}
+
+	input.User = r.Context().Value(key.CtxKeyAuth{}).(user.User)
+
+	recoveryCodes, err := h.userService.ConfirmTwoFactor(r.Context(), input)
+	if err != nil {
+		respondError(w, r, "Failed to confirm two-factor authentication", err)
+		return
+	}
+
+	data := map[string]interface{}{
+		"is_enabled":     true,
+		"recovery_codes": recoveryCodes,
+	}
+
+	response := helper.APIResponse("Two-factor authentication enabled, store the recovery codes safely", http.StatusOK, "success", data)
+	helper.JSON(w, r, response, http.StatusOK)
 }
 
 func (h *userHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(1024)
+	r, span := startSpan(r, "handler.UploadAvatar")
+	defer span.End()
+
+	input := user.UploadAvatarInput{}
+
+	defer helper.RemoveMultipartFiles(r)
+
+	err := helper.Bind(r, &input, helper.MaxBodySize(maxUploadSize))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, "Failed to upload avatar", err)
 		return
 	}
 
-	alias := r.FormValue("alias")
-	uploadedFile, handler, err := r.FormFile("avatar")
+	uploadedFile, err := input.Avatar.Open()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondInternalError(w, r, "Failed to upload avatar", err)
 		return
 	}
 
@@ -195,53 +283,110 @@ func (h *userHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 
 	dir, err := os.Getwd()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondInternalError(w, r, "Failed to upload avatar", err)
 		return
 	}
 
 	// get user data from middleware
 	user := r.Context().Value(key.CtxKeyAuth{}).(user.User)
-	filename := fmt.Sprintf("%d-%s", user.ID, handler.Filename)
+	filename := fmt.Sprintf("%d-%s", user.ID, filepath.Base(input.Avatar.Filename))
 
-	if alias != "" {
-		filename = fmt.Sprintf("%d-%s%s", user.ID, alias, filepath.Ext(handler.Filename))
+	if input.Alias != "" {
+		filename = fmt.Sprintf("%d-%s%s", user.ID, input.Alias, filepath.Ext(input.Avatar.Filename))
 	}
 
 	fileLocation := filepath.Join(dir, "images", filename)
 
-	// update avatar image to database
-	// if error when update to database, cancel upload to local directory
-	_, err = h.userService.UploadAvatar(user.ID, filename)
+	// the file is complete before the user points at it
+	err = writeFile(fileLocation, uploadedFile)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondInternalError(w, r, "Failed to upload avatar", err)
 		return
 	}
 
-	targetFile, err := os.OpenFile(fileLocation, os.O_WRONLY|os.O_CREATE, 0666)
+	_, err = h.userService.UploadAvatar(r.Context(), user.ID, filename)
 	if err != nil {
-		data := map[string]interface{}{
-			"is_uploaded": false,
-		}
+		respondError(w, r, "Failed to upload avatar", err)
+		return
+	}
 
-		response := helper.APIResponse("Failed to upload avatar", http.StatusBadRequest, "error", data)
-		helper.JSON(w, response, http.StatusBadRequest)
+	data := map[string]interface{}{
+		"is_uploaded": true,
+	}
+
+	response := helper.APIResponse("Avatar successfully uploaded!", http.StatusCreated, "success", data)
+	helper.JSON(w, r, response, http.StatusCreated)
+}
+
+func (h *userHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.GetProfile")
+	defer span.End()
+
+	input := campaign.GetCreatorCampaignsInput{}
+	input.Page = 1
+	input.PerPage = 10
+
+	err := helper.Bind(r, &input)
+	if err != nil {
+		respondError(w, r, "Failed to get user profile", err)
+		return
+	}
+
+	creator, err := h.userService.GetUserByID(r.Context(), input.UserID)
+	if err != nil {
+		respondError(w, r, "Failed to get user profile", err)
+		return
+	}
+
+	summary, err := h.campaignService.GetCreatorSummary(r.Context(), creator.ID)
+	if err != nil {
+		respondError(w, r, "Failed to get user profile", err)
+		return
+	}
+
+	campaigns, err := h.campaignService.GetCreatorCampaigns(r.Context(), input)
+	if err != nil {
+		respondError(w, r, "Failed to get user profile", err)
 		return
 	}
 
-	defer targetFile.Close()
+	formatter := campaign.FormatCreatorProfile(creator, summary, campaigns, input)
+	response := helper.APIResponse("User profile", http.StatusOK, "success", formatter)
+	helper.JSON(w, r, response, http.StatusOK)
+}
+
+func (h *userHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.UnlockUser")
+	defer span.End()
 
-	_, err = io.Copy(targetFile, uploadedFile)
+	input := user.UnlockUserInput{}
+
+	err := helper.Bind(r, &input)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		respondError(w, r, "Failed to unlock user", err)
 		return
 	}
 
-	fmt.Println("Success upload to local directory!")
+	unlockedUser, err := h.userService.UnlockUser(r.Context(), input)
+	if err != nil {
+		respondError(w, r, "Failed to unlock user", err)
+		return
+	}
 
 	data := map[string]interface{}{
-		"is_uploaded": true,
+		"id":          unlockedUser.ID,
+		"is_unlocked": true,
 	}
 
-	response := helper.APIResponse("Avatar successfully uploaded!", http.StatusCreated, "success", data)
-	helper.JSON(w, response, http.StatusCreated)
+	response := helper.APIResponse("User has been unlocked", http.StatusOK, "success", data)
+	helper.JSON(w, r, response, http.StatusOK)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
 }
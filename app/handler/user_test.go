@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"bytes"
+	"chi-app/app/campaign"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestGetProfile(t *testing.T) {
+	ctx := context.Background()
+	userRepository := user.NewMemoryUserRepository()
+	campaignRepository := campaign.NewMemoryCampaignRepository(userRepository)
+	userService := user.NewUserService(userRepository, nil, user.DefaultSecurityPolicy())
+	userHandler := NewUserHandler(userService, nil, campaign.NewCampaignService(campaignRepository, nil))
+
+	creator, err := userRepository.Save(ctx, user.User{Name: "Budi", Email: "budi@example.com", Role: "user", AvatarFileName: "1-avatar.png"})
+	if err != nil {
+		t.Fatalf("save creator: %v", err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		_, err := campaignRepository.Save(ctx, campaign.Campaign{UserID: creator.ID, Name: "campaign " + strconv.Itoa(i), ShortDescription: "short", Description: "description", Perks: "perks", GoalAmount: 1000, CurrentAmount: 100})
+		if err != nil {
+			t.Fatalf("save campaign: %v", err)
+		}
+	}
+
+	r := chi.NewRouter()
+	r.Get("/users/{id}", userHandler.GetProfile)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return w
+	}
+
+	path := "/users/" + strconv.Itoa(creator.ID)
+
+	w := get(path + "?page=2&per_page=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: got status %d: %s", path, w.Code, w.Body.String())
+	}
+
+	if strings.Contains(w.Body.String(), creator.Email) || strings.Contains(w.Body.String(), `"email"`) {
+		t.Fatalf("profile shows the email address: %s", w.Body.String())
+	}
+
+	response := struct {
+		Data campaign.CreatorProfileFormatter `json:"data"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode profile: %v", err)
+	}
+
+	profile := response.Data
+	if profile.ID != creator.ID || profile.ImageURL != "/images/1-avatar.png" || profile.CampaignCount != 3 || profile.TotalRaised != 300 {
+		t.Fatalf("unexpected profile: %+v", profile)
+	}
+
+	want := campaign.PaginationFormatter{Page: 2, PerPage: 2, Total: 3, TotalPages: 2}
+	if profile.Pagination != want || len(profile.Campaigns) != 1 {
+		t.Fatalf("second page: got %+v with %d campaigns, want %+v with 1", profile.Pagination, len(profile.Campaigns), want)
+	}
+
+	if w = get(path + "?per_page=51"); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("GET with per_page over the limit: got status %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	if w = get("/users/999"); w.Code != http.StatusNotFound {
+		t.Fatalf("GET unknown user: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestUploadAvatar(t *testing.T) {
+	ctx := context.Background()
+	userRepository := user.NewMemoryUserRepository()
+	userHandler := NewUserHandler(user.NewUserService(userRepository, nil, user.DefaultSecurityPolicy()), nil, nil)
+
+	owner, err := userRepository.Save(ctx, user.User{Name: "Budi", Email: "budi@example.com", Role: "user"})
+	if err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+
+	// uploads go to images/ in the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	if err := os.Mkdir("images", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(alias string, content string) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		form.WriteField("alias", alias)
+		part, _ := form.CreateFormFile("avatar", "photo.png")
+		part.Write([]byte(content))
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/avatars", body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req = req.WithContext(context.WithValue(req.Context(), key.CtxKeyAuth{}, owner))
+
+		w := httptest.NewRecorder()
+		userHandler.UploadAvatar(w, req)
+
+		return w
+	}
+
+	if w := upload("me", "a long first picture"); w.Code != http.StatusCreated {
+		t.Fatalf("first upload: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	// a smaller picture under the same alias replaces the whole file
+	if w := upload("me", "short"); w.Code != http.StatusCreated {
+		t.Fatalf("second upload: got status %d: %s", w.Code, w.Body.String())
+	}
+
+	avatarFileName := strconv.Itoa(owner.ID) + "-me.png"
+
+	content, err := os.ReadFile(filepath.Join(dir, "images", avatarFileName))
+	if err != nil || string(content) != "short" {
+		t.Fatalf("stored avatar: got %q (%v), want %q", content, err, "short")
+	}
+
+	// a file that cannot be written leaves the avatar alone
+	if err := os.RemoveAll("images"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := upload("other", "third picture"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("upload without a directory: got status %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+
+	stored, err := userRepository.FindByID(ctx, owner.ID)
+	if err != nil || stored.AvatarFileName != avatarFileName {
+		t.Fatalf("avatar after a failed upload: got %q (%v), want %q", stored.AvatarFileName, err, avatarFileName)
+	}
+}
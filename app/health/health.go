@@ -0,0 +1,137 @@
+// Package health runs the readiness checks behind GET /readyz.
+package health
+
+import (
+	"chi-app/database"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+type Check func(ctx context.Context) error
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+type Checker struct {
+	mu           sync.Mutex
+	names        []string
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{checks: map[string]Check{}}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.checks[name]; !ok {
+		c.names = append(c.names, name)
+	}
+
+	c.checks[name] = check
+}
+
+// Drain makes every following report unavailable, the load balancer stops
+// sending traffic while in-flight requests finish.
+func (c *Checker) Drain() {
+	c.shuttingDown.Store(true)
+}
+
+// Check runs all checks, also while draining so the report still shows
+// what is healthy. The report is served to anonymous callers, so it only
+// tells which check failed; the error itself is logged.
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.Lock()
+	names := append([]string{}, c.names...)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.Unlock()
+
+	report := Report{Status: StatusOK, Checks: map[string]string{}}
+
+	results := make([]error, len(names))
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}(i, check)
+	}
+
+	wg.Wait()
+
+	for i, name := range names {
+		report.Checks[name] = StatusOK
+		if results[i] != nil {
+			slog.WarnContext(ctx, "readiness check failed", slog.String("check", name), slog.Any("error", results[i]))
+
+			report.Checks[name] = StatusUnavailable
+			report.Status = StatusUnavailable
+		}
+	}
+
+	if c.shuttingDown.Load() {
+		report.Status = StatusShuttingDown
+	}
+
+	return report
+}
+
+func DatabaseCheck(db *database.DB) Check {
+	return func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	}
+}
+
+// StorageCheck makes sure uploads can be written to dir.
+func StorageCheck(dir string) Check {
+	return func(ctx context.Context) error {
+		file, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+
+		file.Close()
+		return os.Remove(file.Name())
+	}
+}
+
+// MigrationsCheck fails while the schema is behind the migrations the
+// binary ships with.
+func MigrationsCheck(migrator *database.Migrator) Check {
+	return func(ctx context.Context) error {
+		pending, err := migrator.Pending(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(pending) > 0 {
+			return fmt.Errorf("%d pending migration(s), first %04d_%s", len(pending), pending[0].Version, pending[0].Name)
+		}
+
+		return nil
+	}
+}
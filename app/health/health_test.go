@@ -0,0 +1,91 @@
+package health
+
+import (
+	"chi-app/database"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestChecker(t *testing.T) {
+	ctx := context.Background()
+
+	checker := NewChecker()
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.Add("storage", func(ctx context.Context) error { return nil })
+
+	report := checker.Check(ctx)
+	if !report.Ready() || report.Checks["database"] != StatusOK || report.Checks["storage"] != StatusOK {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	checker.Add("storage", func(ctx context.Context) error { return errors.New("disk full") })
+
+	report = checker.Check(ctx)
+	if report.Ready() || report.Status != StatusUnavailable || report.Checks["storage"] != StatusUnavailable {
+		t.Fatalf("failing check not reported: %+v", report)
+	}
+
+	checker.Drain()
+
+	report = checker.Check(ctx)
+	if report.Status != StatusShuttingDown || report.Checks["database"] != StatusOK {
+		t.Fatalf("draining not reported: %+v", report)
+	}
+}
+
+func TestStorageCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	err := StorageCheck(dir)(context.Background())
+	if err != nil {
+		t.Fatalf("writable dir: %v", err)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(matches) != 0 {
+		t.Fatalf("probe file left behind: %v", matches)
+	}
+
+	err = StorageCheck(filepath.Join(dir, "missing"))(context.Background())
+	if err == nil {
+		t.Fatal("missing dir reported as writable")
+	}
+}
+
+func TestDatabaseChecks(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.NewSQLite(t)
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DatabaseCheck(db)(ctx); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+
+	if err := MigrationsCheck(migrator)(ctx); err != nil {
+		t.Fatalf("migrated database: %v", err)
+	}
+
+	// a readiness probe that gave up does not keep querying
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	if err := MigrationsCheck(migrator)(cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled check: got %v, want context.Canceled", err)
+	}
+
+	_, err = migrator.Down(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigrationsCheck(migrator)(ctx); err == nil {
+		t.Fatal("pending migration not reported")
+	}
+}
@@ -0,0 +1,381 @@
+package helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// DefaultMaxBodySize limits JSON and url encoded bodies.
+	DefaultMaxBodySize int64 = 1 << 20
+
+	// multipartMemory is how much of a multipart body is kept in memory,
+	// the rest of the files are spooled to temporary files.
+	multipartMemory int64 = 1 << 20
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("content type must be application/json, application/x-www-form-urlencoded or multipart/form-data")
+	ErrBodyTooLarge         = errors.New("request body is too large")
+	ErrEmptyBody            = errors.New("request body must not be empty")
+
+	// ErrInvalidRequest is matched by every error Bind returns for a body,
+	// query or route parameter it could not read, such as malformed JSON
+	// or a value of the wrong type. Their messages are safe to show.
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+var fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+
+// BindError reports a request value that could not be stored in the
+// input field it was sent for.
+type BindError struct {
+	Field string
+	Err   error
+}
+
+func (e *BindError) Error() string {
+	return fmt.Sprintf("%s has an invalid value", e.Field)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+type invalidRequestError struct {
+	err error
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invalidRequestError) Unwrap() []error {
+	return []error{e.err, ErrInvalidRequest}
+}
+
+// invalidRequest marks err as a request the client has to fix, unless it
+// already has a status of its own.
+func invalidRequest(err error) error {
+	if err == nil || errors.Is(err, ErrUnsupportedMediaType) || errors.Is(err, ErrBodyTooLarge) {
+		return err
+	}
+
+	return &invalidRequestError{err}
+}
+
+type bindOptions struct {
+	maxBodySize           int64
+	disallowUnknownFields bool
+}
+
+type BindOption func(*bindOptions)
+
+// MaxBodySize overrides DefaultMaxBodySize, uploads need more room.
+func MaxBodySize(size int64) BindOption {
+	return func(o *bindOptions) {
+		o.maxBodySize = size
+	}
+}
+
+// DisallowUnknownFields rejects bodies with fields the input does not
+// declare instead of silently dropping them.
+func DisallowUnknownFields() BindOption {
+	return func(o *bindOptions) {
+		o.disallowUnknownFields = true
+	}
+}
+
+// Bind fills input from the request and validates it. The body is decoded
+// by content type into json or form tagged fields, query and uri tags are
+// read from the query string and the chi route parameters. Inputs without
+// json or form tags leave the body alone, so a handler can bind the route
+// parameters and the body into separate inputs.
+func Bind(r *http.Request, input interface{}, options ...BindOption) error {
+	o := bindOptions{maxBodySize: DefaultMaxBodySize}
+	for _, option := range options {
+		option(&o)
+	}
+
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic("helper: Bind needs a pointer to a struct")
+	}
+
+	v = v.Elem()
+
+	if hasTag(v.Type(), "json") || hasTag(v.Type(), "form") {
+		err := bindBody(r, input, v, o)
+		if err != nil {
+			return invalidRequest(err)
+		}
+	}
+
+	err := bindValues(v, "query", r.URL.Query(), false)
+	if err != nil {
+		return invalidRequest(err)
+	}
+
+	err = bindValues(v, "uri", routeParams(r), false)
+	if err != nil {
+		return invalidRequest(err)
+	}
+
+	return Validate(input)
+}
+
+// RemoveMultipartFiles deletes the temporary files a multipart body bound
+// by Bind was spooled to. net/http only removes them for the request it
+// handed to the handler chain, not for copies made with WithContext, so
+// handlers binding uploads defer this before calling Bind.
+func RemoveMultipartFiles(r *http.Request) {
+	if r.MultipartForm != nil {
+		r.MultipartForm.RemoveAll()
+	}
+}
+
+func bindBody(r *http.Request, input interface{}, v reflect.Value, o bindOptions) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" && (r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0) {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ErrUnsupportedMediaType
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, o.maxBodySize)
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return bindJSON(r.Body, input, o)
+	case mediaType == "application/x-www-form-urlencoded":
+		err = r.ParseForm()
+		if err != nil {
+			return bodyError(err)
+		}
+
+		return bindValues(v, "form", r.PostForm, o.disallowUnknownFields)
+	case mediaType == "multipart/form-data":
+		err = r.ParseMultipartForm(multipartMemory)
+		if err != nil {
+			return bodyError(err)
+		}
+
+		err = bindValues(v, "form", r.MultipartForm.Value, o.disallowUnknownFields)
+		if err != nil {
+			return err
+		}
+
+		return bindFiles(v, r.MultipartForm.File, o.disallowUnknownFields)
+	}
+
+	return ErrUnsupportedMediaType
+}
+
+func bindJSON(body io.Reader, input interface{}, o bindOptions) error {
+	decoder := json.NewDecoder(body)
+	if o.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	err := decoder.Decode(input)
+	if errors.Is(err, io.EOF) {
+		return ErrEmptyBody
+	}
+
+	if err != nil {
+		return bodyError(err)
+	}
+
+	if decoder.More() {
+		return errors.New("request body must contain a single JSON object")
+	}
+
+	return nil
+}
+
+func bodyError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrBodyTooLarge
+	}
+
+	return err
+}
+
+func routeParams(r *http.Request) map[string][]string {
+	params := map[string][]string{}
+
+	routeCtx := chi.RouteContext(r.Context())
+	if routeCtx == nil {
+		return params
+	}
+
+	for i, key := range routeCtx.URLParams.Keys {
+		params[key] = []string{routeCtx.URLParams.Values[i]}
+	}
+
+	return params
+}
+
+// bindValues copies values into the fields tagged with tag. Keys no field
+// claims are an error only when strict is set.
+func bindValues(v reflect.Value, tag string, values map[string][]string, strict bool) error {
+	known := map[string]bool{}
+
+	for i := 0; i < v.NumField(); i++ {
+		name := fieldName(v.Type().Field(i), tag)
+		if name == "" || v.Type().Field(i).Type == fileHeaderType {
+			continue
+		}
+
+		known[name] = true
+
+		fieldValues, ok := values[name]
+		if !ok || len(fieldValues) == 0 {
+			continue
+		}
+
+		err := setField(v.Field(i), fieldValues)
+		if err != nil {
+			return &BindError{Field: name, Err: err}
+		}
+	}
+
+	if strict {
+		for name := range values {
+			if !known[name] {
+				return fmt.Errorf("unknown field %q", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func bindFiles(v reflect.Value, files map[string][]*multipart.FileHeader, strict bool) error {
+	known := map[string]bool{}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		name := fieldName(field, "form")
+		if name == "" || field.Type != fileHeaderType {
+			continue
+		}
+
+		known[name] = true
+
+		if fileHeaders := files[name]; len(fileHeaders) > 0 {
+			v.Field(i).Set(reflect.ValueOf(fileHeaders[0]))
+		}
+	}
+
+	if strict {
+		for name := range files {
+			if !known[name] {
+				return fmt.Errorf("unknown field %q", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, value := range values {
+			err := setValue(slice.Index(i), value)
+			if err != nil {
+				return err
+			}
+		}
+
+		field.Set(slice)
+		return nil
+	}
+
+	return setValue(field, values[0])
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+
+	return nil
+}
+
+func hasTag(t reflect.Type, tag string) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if tagName(t.Field(i), tag) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fieldName falls back to the json name for form values, so a JSON input
+// can be posted as a form without tagging every field twice.
+func fieldName(field reflect.StructField, tag string) string {
+	name := tagName(field, tag)
+	if name == "" && tag == "form" && field.Tag.Get("form") == "" {
+		return tagName(field, "json")
+	}
+
+	return name
+}
+
+func tagName(field reflect.StructField, tag string) string {
+	name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+	if name == "-" || !field.IsExported() {
+		return ""
+	}
+
+	return name
+}
@@ -0,0 +1,282 @@
+package helper
+
+import (
+	"bytes"
+	"chi-app/app/i18n"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+)
+
+type campaignInput struct {
+	Name       string `json:"name" validate:"required"`
+	GoalAmount int    `json:"goal_amount" validate:"required,currency"`
+}
+
+type uploadInput struct {
+	CampaignID int                   `form:"campaign_id" validate:"required"`
+	IsPrimary  bool                  `form:"is_primary"`
+	File       *multipart.FileHeader `form:"file" validate:"required"`
+}
+
+type pageInput struct {
+	ID      int `uri:"id" validate:"required"`
+	Page    int `query:"page" validate:"min=1"`
+	PerPage int `query:"per_page" validate:"min=1,max=50"`
+}
+
+func newJSONRequest(body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/campaigns", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return r
+}
+
+func TestBindJSON(t *testing.T) {
+	input := campaignInput{}
+
+	err := Bind(newJSONRequest(`{"name":"Sedekah","goal_amount":5000}`), &input)
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	if input.Name != "Sedekah" || input.GoalAmount != 5000 {
+		t.Fatalf("unexpected input: %+v", input)
+	}
+
+	err = Bind(newJSONRequest(`{"name":"Sedekah","goal_amount":-1}`), &campaignInput{})
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) || validationErrors[0].Tag() != "currency" {
+		t.Fatalf("got %v, want a currency validation error", err)
+	}
+
+	err = Bind(newJSONRequest(``), &campaignInput{})
+	if !errors.Is(err, ErrEmptyBody) || !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("empty body: got %v", err)
+	}
+
+	err = Bind(newJSONRequest(`{"name":"a","goal_amount":1} {}`), &campaignInput{})
+	if err == nil {
+		t.Fatal("accepted two JSON values")
+	}
+}
+
+func TestBindUnknownFields(t *testing.T) {
+	body := `{"name":"Sedekah","goal_amount":5000,"user_id":1}`
+
+	err := Bind(newJSONRequest(body), &campaignInput{})
+	if err != nil {
+		t.Fatalf("lenient bind: %v", err)
+	}
+
+	err = Bind(newJSONRequest(body), &campaignInput{}, DisallowUnknownFields())
+	if err == nil || !strings.Contains(err.Error(), "user_id") {
+		t.Fatalf("strict bind: got %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/campaigns", strings.NewReader("name=Sedekah&goal_amount=5000&user_id=1"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	err = Bind(r, &campaignInput{}, DisallowUnknownFields())
+	if err == nil || !strings.Contains(err.Error(), "user_id") {
+		t.Fatalf("strict form bind: got %v", err)
+	}
+}
+
+func TestBindBodyLimits(t *testing.T) {
+	err := Bind(newJSONRequest(`{"name":"`+strings.Repeat("a", 64)+`"}`), &campaignInput{}, MaxBodySize(32))
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("got %v, want ErrBodyTooLarge", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/campaigns", strings.NewReader("<campaign/>"))
+	r.Header.Set("Content-Type", "application/xml")
+
+	err = Bind(r, &campaignInput{})
+	if !errors.Is(err, ErrUnsupportedMediaType) {
+		t.Fatalf("got %v, want ErrUnsupportedMediaType", err)
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	form := url.Values{"name": {"Sedekah"}, "goal_amount": {"5000"}}
+	r := httptest.NewRequest(http.MethodPost, "/campaigns", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	input := campaignInput{}
+
+	err := Bind(r, &input)
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	if input.Name != "Sedekah" || input.GoalAmount != 5000 {
+		t.Fatalf("json names not used for form values: %+v", input)
+	}
+
+	form.Set("goal_amount", "lots")
+	r = httptest.NewRequest(http.MethodPost, "/campaigns", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	err = Bind(r, &campaignInput{})
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) || bindErr.Field != "goal_amount" || !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("got %v, want an invalid request BindError for goal_amount", err)
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("campaign_id", "7")
+	writer.WriteField("is_primary", "true")
+
+	part, err := writer.CreateFormFile("file", "cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	part.Write([]byte("png"))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/campaign-images", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	input := uploadInput{}
+
+	err = Bind(r, &input)
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	if input.CampaignID != 7 || !input.IsPrimary || input.File == nil || input.File.Filename != "cover.png" {
+		t.Fatalf("unexpected input: %+v", input)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/campaign-images", strings.NewReader(""))
+	r.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+	err = Bind(r, &uploadInput{})
+	if err == nil {
+		t.Fatal("bound a multipart request without a file")
+	}
+}
+
+func TestRemoveMultipartFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("TMPDIR", tempDir)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("campaign_id", "7")
+
+	part, err := writer.CreateFormFile("file", "cover.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// larger than what is kept in memory, so it is spooled to disk
+	part.Write(bytes.Repeat([]byte("a"), int(multipartMemory)+1))
+	writer.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/campaign-images", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+
+	err = Bind(r, &uploadInput{}, MaxBodySize(4*multipartMemory))
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	spooled, _ := os.ReadDir(tempDir)
+	if len(spooled) == 0 {
+		t.Fatal("upload was not spooled to a temporary file")
+	}
+
+	RemoveMultipartFiles(r)
+
+	spooled, _ = os.ReadDir(tempDir)
+	if len(spooled) != 0 {
+		t.Fatalf("temporary files left behind: %v", spooled)
+	}
+}
+
+func TestBindRouteAndQuery(t *testing.T) {
+	var input pageInput
+	var err error
+
+	router := chi.NewRouter()
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		input = pageInput{Page: 1, PerPage: 10}
+		err = Bind(r, &input)
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/3?per_page=20", nil))
+	if err != nil {
+		t.Fatalf("bind: %v", err)
+	}
+
+	if input.ID != 3 || input.Page != 1 || input.PerPage != 20 {
+		t.Fatalf("unexpected input: %+v", input)
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/abc", nil))
+	var bindErr *BindError
+	if !errors.As(err, &bindErr) || bindErr.Field != "id" {
+		t.Fatalf("got %v, want a BindError for id", err)
+	}
+}
+
+func TestCustomRules(t *testing.T) {
+	tests := []struct {
+		rule  string
+		value interface{}
+		valid bool
+	}{
+		{"slug", "sedekah-jumat-2", true},
+		{"slug", "Sedekah Jumat", false},
+		{"slug", "-sedekah", false},
+		{"currency", 5000, true},
+		{"currency", 0, false},
+		{"currency", 12.5, true},
+		{"currency", 12.555, false},
+		{"currency", "1500.75", true},
+		{"currency", "0.00", false},
+		{"currency", "1,500", false},
+		{"safe_filename", "avatar.png", true},
+		{"safe_filename", "my-avatar_2", true},
+		{"safe_filename", "../etc/passwd", false},
+		{"safe_filename", "a/b.png", false},
+		{"safe_filename", ".env", false},
+	}
+
+	for _, test := range tests {
+		err := validate.Var(test.value, test.rule)
+		if (err == nil) != test.valid {
+			t.Errorf("%s(%v): got %v, want valid=%v", test.rule, test.value, err, test.valid)
+		}
+	}
+}
+
+func TestCustomRuleMessages(t *testing.T) {
+	err := Validate(campaignInput{Name: "Sedekah", GoalAmount: -1})
+
+	tests := map[string]string{
+		i18n.English:    "goal_amount must be a positive amount with at most two decimals",
+		i18n.Indonesian: "goal_amount harus berupa nominal positif dengan maksimal dua angka desimal",
+	}
+
+	for lang, want := range tests {
+		got := FormatValidationErrors(i18n.WithLanguage(context.Background(), lang), err)
+		if len(got) != 1 || got[0].Message != want {
+			t.Errorf("%s: got %+v, want %q", lang, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WeakETag quotes value as a weak entity tag.
+func WeakETag(value string) string {
+	return `W/"` + value + `"`
+}
+
+// NotModified sets the validators of a cacheable response and answers
+// 304 when the client already has that representation. If-None-Match wins
+// over If-Modified-Since, as RFC 9110 asks. etag is made per format with
+// RepresentationETag. Handlers call it before formatting the response and
+// stop when it returns true.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	etag = RepresentationETag(r, etag)
+	addVary(w, "Accept")
+
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	// clients may keep the response but have to revalidate it every time
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	notModified := false
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		notModified = MatchETag(ifNoneMatch, etag)
+	} else if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		notModified = err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+	}
+
+	return notModified
+}
+
+// MatchETag reports whether the list of tags of an If-Match or
+// If-None-Match header holds etag, or is "*". Tags are compared weakly,
+// W/"a" matches "a", and the suffix of EncodedETag is ignored.
+func MatchETag(header string, etag string) bool {
+	etag = DecodedETag(strings.TrimPrefix(etag, "W/"))
+	for _, candidate := range ETags(header) {
+		if candidate == "*" || DecodedETag(strings.TrimPrefix(candidate, "W/")) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentEncodings are the encodings EncodedETag may add to a tag.
+var contentEncodings = []string{"gzip", "br"}
+
+// EncodedETag tells a compressed response apart from the identity one,
+// the bytes differ so they must not share a strong tag.
+func EncodedETag(etag string, encoding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// DecodedETag strips what EncodedETag added.
+func DecodedETag(etag string) string {
+	for _, encoding := range contentEncodings {
+		if strings.HasSuffix(etag, "-"+encoding+`"`) {
+			return strings.TrimSuffix(etag, "-"+encoding+`"`) + `"`
+		}
+	}
+
+	return etag
+}
+
+// ETags splits the list of tags of an If-Match or If-None-Match header.
+func ETags(header string) []string {
+	etags := []string{}
+	for _, etag := range strings.Split(header, ",") {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+
+	return etags
+}
@@ -0,0 +1,242 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	JSONContentType        = "application/json"
+	MessagePackContentType = "application/msgpack"
+	CSVContentType         = "text/csv"
+)
+
+// Format is a representation JSON can write a response in.
+type Format string
+
+const (
+	FormatJSON        Format = "json"
+	FormatMessagePack Format = "msgpack"
+	FormatCSV         Format = "csv"
+)
+
+// mediaTypes maps what clients send in Accept to a format. MessagePack
+// has no registered media type, the common spellings are all accepted.
+var mediaTypes = map[string]Format{
+	"*/*":                     FormatJSON,
+	"application/*":           FormatJSON,
+	JSONContentType:           FormatJSON,
+	MessagePackContentType:    FormatMessagePack,
+	"application/x-msgpack":   FormatMessagePack,
+	"application/vnd.msgpack": FormatMessagePack,
+	"text/*":                  FormatCSV,
+	CSVContentType:            FormatCSV,
+}
+
+// formatPreference breaks ties between media types of the same quality.
+var formatPreference = map[Format]int{FormatJSON: 3, FormatMessagePack: 2, FormatCSV: 1}
+
+// NegotiateFormat picks the format the Accept header prefers. JSON is the
+// default, for a missing Accept header and for one listing nothing else
+// this server speaks.
+func NegotiateFormat(r *http.Request) Format {
+	best, bestQuality := FormatJSON, -1.0
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		format, ok := mediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+
+		if quality <= 0 {
+			continue
+		}
+
+		if quality > bestQuality || quality == bestQuality && formatPreference[format] > formatPreference[best] {
+			best, bestQuality = format, quality
+		}
+	}
+
+	return best
+}
+
+// RepresentationETag tells the formats of the same resource apart, a
+// cache must not answer a MessagePack request with the JSON it kept.
+func RepresentationETag(r *http.Request, etag string) string {
+	format := NegotiateFormat(r)
+	if format == FormatJSON || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+
+	return strings.TrimSuffix(etag, `"`) + "-" + string(format) + `"`
+}
+
+// BaseETag strips what RepresentationETag and EncodedETag added.
+func BaseETag(etag string) string {
+	etag = DecodedETag(etag)
+	for _, format := range []Format{FormatMessagePack, FormatCSV} {
+		if strings.HasSuffix(etag, "-"+string(format)+`"`) {
+			return strings.TrimSuffix(etag, "-"+string(format)+`"`) + `"`
+		}
+	}
+
+	return etag
+}
+
+// addVary lists header in Vary once.
+func addVary(w http.ResponseWriter, header string) {
+	for _, value := range w.Header().Values("Vary") {
+		for _, varied := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(varied), header) {
+				return
+			}
+		}
+	}
+
+	w.Header().Add("Vary", header)
+}
+
+// encode writes p in format and returns the body with its content type.
+// CSV only fits a list, every other response falls back to JSON.
+func encode(p interface{}, format Format, status int) ([]byte, string, error) {
+	switch format {
+	case FormatMessagePack:
+		body := &bytes.Buffer{}
+		encoder := msgpack.NewEncoder(body)
+		encoder.SetCustomStructTag("json")
+
+		err := encoder.Encode(p)
+		return body.Bytes(), MessagePackContentType, err
+	case FormatCSV:
+		if response, ok := p.(ResponseFormatter); ok && status < http.StatusBadRequest && isList(response.Data) {
+			body, err := encodeCSV(response.Data)
+			return body, CSVContentType + "; charset=utf-8", err
+		}
+	}
+
+	body, err := json.Marshal(p)
+	return body, JSONContentType, err
+}
+
+func isList(data interface{}) bool {
+	value := reflect.ValueOf(data)
+	return value.Kind() == reflect.Slice || value.Kind() == reflect.Array
+}
+
+// encodeCSV writes one row per element of list under a header row. The
+// columns are the JSON fields of the elements, nested values are written
+// as JSON so nothing is lost.
+func encodeCSV(list interface{}) ([]byte, error) {
+	// going through JSON keeps the names and omissions of the JSON body
+	encodedData, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]json.RawMessage{}
+	err = json.Unmarshal(encodedData, &rows)
+	if err != nil {
+		return nil, fmt.Errorf("csv needs a list of objects: %w", err)
+	}
+
+	columns := csvColumns(reflect.TypeOf(list).Elem(), rows)
+
+	body := &bytes.Buffer{}
+	writer := csv.NewWriter(body)
+	writer.Write(columns)
+
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = csvCell(row[column])
+		}
+
+		writer.Write(record)
+	}
+
+	writer.Flush()
+
+	return body.Bytes(), writer.Error()
+}
+
+// csvColumns keeps the field order of a struct element, the keys of maps
+// have no order and are sorted.
+func csvColumns(elem reflect.Type, rows []map[string]json.RawMessage) []string {
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+
+	columns := []string{}
+	seen := map[string]bool{}
+
+	if elem.Kind() == reflect.Struct {
+		for i := 0; i < elem.NumField(); i++ {
+			field := elem.Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" || field.Anonymous && name == "" {
+				continue
+			}
+
+			if name == "" {
+				name = field.Name
+			}
+
+			columns = append(columns, name)
+			seen[name] = true
+		}
+	}
+
+	extra := []string{}
+	for _, row := range rows {
+		for name := range row {
+			if !seen[name] {
+				extra = append(extra, name)
+				seen[name] = true
+			}
+		}
+	}
+
+	sort.Strings(extra)
+
+	return append(columns, extra...)
+}
+
+// csvCell unquotes strings and keeps numbers, booleans and nested values
+// as JSON. Strings a spreadsheet would run as a formula are prefixed with
+// a quote, the export is meant to be opened in one.
+func csvCell(value json.RawMessage) string {
+	if len(value) == 0 || string(value) == "null" {
+		return ""
+	}
+
+	var s string
+	if json.Unmarshal(value, &s) != nil {
+		return string(value)
+	}
+
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+
+	return s
+}
@@ -0,0 +1,150 @@
+package helper
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+type exportRow struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Perks  []string `json:"perks"`
+	Secret string   `json:"-"`
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{"", FormatJSON},
+		{"*/*", FormatJSON},
+		{"text/html", FormatJSON},
+		{"application/msgpack", FormatMessagePack},
+		{"application/x-msgpack", FormatMessagePack},
+		{"text/csv", FormatCSV},
+		{"text/csv;q=0.5, application/msgpack", FormatMessagePack},
+		{"application/json;q=0.1, text/csv", FormatCSV},
+		{"text/csv, application/json", FormatJSON},
+		{"application/msgpack;q=0, */*;q=0.1", FormatJSON},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", test.accept)
+
+		if got := NegotiateFormat(r); got != test.want {
+			t.Errorf("NegotiateFormat(%q) = %q, want %q", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestJSONFormats(t *testing.T) {
+	rows := []exportRow{
+		{ID: 1, Name: "Clean water", Perks: []string{"sticker", "t-shirt"}, Secret: "hidden"},
+		{ID: 2, Name: "=HYPERLINK(\"http://example.com\")"},
+	}
+
+	serve := func(accept string, data interface{}, status int) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+
+		w := httptest.NewRecorder()
+		JSON(w, r, APIResponse("List of campaigns", status, "success", data), status)
+
+		return w
+	}
+
+	w := serve("text/csv", rows, http.StatusOK)
+	if w.Header().Get("Content-Type") != "text/csv; charset=utf-8" || w.Header().Get("Vary") != "Accept" {
+		t.Fatalf("got headers %v, want a CSV response varying by Accept", w.Header())
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+
+	want := [][]string{
+		{"id", "name", "perks"},
+		{"1", "Clean water", `["sticker","t-shirt"]`},
+		{"2", `'=HYPERLINK("http://example.com")`, ""},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Fatalf("got csv %q, want %q", records, want)
+	}
+
+	// CSV only fits lists, anything else stays JSON
+	for _, w := range []*httptest.ResponseRecorder{serve("text/csv", rows[0], http.StatusOK), serve("text/csv", nil, http.StatusNotFound)} {
+		if w.Header().Get("Content-Type") != JSONContentType || !strings.HasPrefix(w.Body.String(), `{"meta":`) {
+			t.Fatalf("got %q %s, want the JSON envelope", w.Header().Get("Content-Type"), w.Body.String())
+		}
+	}
+
+	w = serve("application/msgpack", rows, http.StatusOK)
+	if w.Header().Get("Content-Type") != MessagePackContentType {
+		t.Fatalf("got Content-Type %q, want %q", w.Header().Get("Content-Type"), MessagePackContentType)
+	}
+
+	decoded := struct {
+		Meta Meta        `msgpack:"meta"`
+		Data []exportRow `msgpack:"data"`
+	}{}
+	decoder := msgpack.NewDecoder(w.Body)
+	decoder.SetCustomStructTag("json")
+
+	err = decoder.Decode(&decoded)
+	if err != nil {
+		t.Fatalf("decode msgpack: %v", err)
+	}
+
+	if decoded.Meta.Message != "List of campaigns" || len(decoded.Data) != 2 || decoded.Data[0].Name != "Clean water" || decoded.Data[0].Secret != "" {
+		t.Fatalf("got %+v, want the envelope with both rows", decoded)
+	}
+}
+
+func TestRepresentationETag(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	etag := WeakETag("abc")
+
+	if got := RepresentationETag(r, etag); got != etag {
+		t.Fatalf("JSON tag = %q, want %q", got, etag)
+	}
+
+	r.Header.Set("Accept", "application/msgpack")
+	tagged := RepresentationETag(r, etag)
+	if tagged == etag || BaseETag(tagged) != etag {
+		t.Fatalf("MessagePack tag = %q, base %q, want a distinct tag based on %q", tagged, BaseETag(tagged), etag)
+	}
+
+	w := httptest.NewRecorder()
+	r.Header.Set("If-None-Match", etag)
+	if NotModified(w, r, etag, time.Time{}) {
+		t.Fatal("the JSON tag must not validate the MessagePack representation")
+	}
+
+	w = httptest.NewRecorder()
+	r.Header.Set("If-None-Match", tagged)
+	if !NotModified(w, r, etag, time.Time{}) || w.Code != http.StatusNotModified {
+		t.Fatalf("got status %d, want %d for the matching MessagePack tag", w.Code, http.StatusNotModified)
+	}
+
+	// the compression middleware adds its encoding after the format
+	encoded := EncodedETag(tagged, "gzip")
+	if encoded == tagged || BaseETag(encoded) != etag {
+		t.Fatalf("gzip tag = %q, base %q, want a distinct tag based on %q", encoded, BaseETag(encoded), etag)
+	}
+
+	w = httptest.NewRecorder()
+	r.Header.Set("If-None-Match", encoded)
+	if !NotModified(w, r, etag, time.Time{}) || w.Code != http.StatusNotModified {
+		t.Fatalf("got status %d, want %d for the matching gzip tag", w.Code, http.StatusNotModified)
+	}
+}
@@ -0,0 +1,89 @@
+package helper
+
+import (
+	"chi-app/app/i18n"
+	"chi-app/app/logging"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 error body, sent instead of the usual envelope
+// to clients that ask for application/problem+json.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// RequestID is an extension member, the same ID is in the
+	// X-Request-ID header and in the server logs
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error writes an error response in the format the client negotiated:
+// problem+json when it is accepted, the standard envelope with the field
+// errors in meta otherwise. Both carry the request ID.
+func Error(w http.ResponseWriter, r *http.Request, message string, code int, data interface{}, fieldErrors []FieldError) {
+	if detail, ok := data.(string); ok {
+		data = i18n.T(r.Context(), detail)
+	}
+
+	if !AcceptsProblem(r) {
+		response := APIResponse(message, code, "error", data)
+		response.Meta.Errors = fieldErrors
+		JSON(w, r, response, code)
+		return
+	}
+
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    i18n.T(r.Context(), message),
+		Status:   code,
+		Instance: r.URL.Path,
+		Errors:   fieldErrors,
+
+		RequestID: logging.RequestID(r.Context()),
+	}
+
+	if detail, ok := data.(string); ok {
+		problem.Detail = detail
+	}
+
+	addVary(w, "Accept")
+
+	encodedData, err := json.Marshal(problem)
+	if err != nil {
+		marshalError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(code)
+	w.Write(encodedData)
+}
+
+// AcceptsProblem reports whether the Accept header lists
+// application/problem+json with a non-zero quality.
+func AcceptsProblem(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || mediaType != ProblemContentType {
+			continue
+		}
+
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"chi-app/app/i18n"
+	"chi-app/app/logging"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type signupInput struct {
+	Email  string   `json:"email" validate:"required,email"`
+	Name   string   `json:"name" validate:"required,max=5"`
+	Scopes []string `json:"scopes" validate:"min=1,dive,oneof=read write"`
+}
+
+func TestFormatValidationErrors(t *testing.T) {
+	err := Validate(signupInput{Email: "not-an-email", Name: "too long", Scopes: []string{"admin"}})
+	if err == nil {
+		t.Fatal("expected validation to fail")
+	}
+
+	tests := []struct {
+		lang string
+		want []FieldError
+	}{
+		{i18n.English, []FieldError{
+			{Field: "email", Code: "email", Message: "email must be a valid email address"},
+			{Field: "name", Code: "max", Message: "name must be a maximum of 5 characters in length"},
+			{Field: "scopes[0]", Code: "oneof", Message: "scopes[0] must be one of [read write]"},
+		}},
+		{i18n.Indonesian, []FieldError{
+			{Field: "email", Code: "email", Message: "email harus berupa alamat email yang valid"},
+			{Field: "name", Code: "max", Message: "panjang maksimal name adalah 5 karakter"},
+			{Field: "scopes[0]", Code: "oneof", Message: "scopes[0] harus berupa salah satu dari [read write]"},
+		}},
+	}
+
+	for _, test := range tests {
+		got := FormatValidationErrors(i18n.WithLanguage(context.Background(), test.lang), err)
+
+		if len(got) != len(test.want) {
+			t.Fatalf("%s: got %+v, want %+v", test.lang, got, test.want)
+		}
+
+		for i := range test.want {
+			if got[i] != test.want[i] {
+				t.Errorf("%s error %d: got %+v, want %+v", test.lang, i, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+func TestErrorNegotiation(t *testing.T) {
+	fieldErrors := []FieldError{{Field: "email", Code: "required", Message: "email is required"}}
+
+	t.Run("envelope", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/users", nil)
+		r = r.WithContext(logging.WithRequestID(r.Context(), "req-1"))
+		w := httptest.NewRecorder()
+
+		Error(w, r, "Failed register user", http.StatusUnprocessableEntity, nil, fieldErrors)
+
+		if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Fatalf("got content type %q", contentType)
+		}
+
+		response := ResponseFormatter{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+
+		if response.Meta.Code != http.StatusUnprocessableEntity || len(response.Meta.Errors) != 1 || response.Meta.Errors[0] != fieldErrors[0] || response.Meta.RequestID != "req-1" {
+			t.Fatalf("unexpected meta: %+v", response.Meta)
+		}
+	})
+
+	t.Run("problem", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/users", nil)
+		r.Header.Set("Accept", "application/json;q=0.9, application/problem+json")
+		r = r.WithContext(logging.WithRequestID(r.Context(), "req-2"))
+		w := httptest.NewRecorder()
+
+		Error(w, r, "Failed register user", http.StatusUnprocessableEntity, nil, fieldErrors)
+
+		if contentType := w.Header().Get("Content-Type"); contentType != ProblemContentType {
+			t.Fatalf("got content type %q", contentType)
+		}
+
+		problem := Problem{}
+		if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+			t.Fatal(err)
+		}
+
+		if problem.Status != http.StatusUnprocessableEntity || problem.Instance != "/api/v1/users" || len(problem.Errors) != 1 || problem.RequestID != "req-2" {
+			t.Fatalf("unexpected problem: %+v", problem)
+		}
+	})
+
+	t.Run("problem refused", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", "application/problem+json;q=0")
+
+		if AcceptsProblem(r) {
+			t.Fatal("q=0 must not select problem+json")
+		}
+	})
+}
@@ -1,15 +1,19 @@
 package helper
 
 import (
+	"chi-app/app/i18n"
+	"chi-app/app/logging"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 )
 
 type Meta struct {
-	Message string `json:"message"`
-	Code    int    `json:"code"`
-	Status  string `json:"status"`
+	Message   string       `json:"message"`
+	Code      int          `json:"code"`
+	Status    string       `json:"status"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
 }
 
 type ResponseFormatter struct {
@@ -17,17 +21,48 @@ type ResponseFormatter struct {
 	Data interface{} `json:"data"`
 }
 
-func JSON(w http.ResponseWriter, p interface{}, status int) {
-	encodedData, err := json.Marshal(p)
+// JSON writes p with the given status in the format the Accept header
+// asks for: JSON, MessagePack, or CSV for lists. The message of a
+// standard envelope is translated into the request language on the way
+// out, and error envelopes get the request ID.
+func JSON(w http.ResponseWriter, r *http.Request, p interface{}, status int) {
+	if response, ok := p.(ResponseFormatter); ok {
+		response.Meta.Message = i18n.T(r.Context(), response.Meta.Message)
+		if status >= http.StatusBadRequest {
+			response.Meta.RequestID = logging.RequestID(r.Context())
+		}
+
+		p = response
+	}
+
+	addVary(w, "Accept")
+
+	encodedData, contentType, err := encode(p, NegotiateFormat(r), status)
 	if err != nil {
-		log.Fatal(err)
+		marshalError(w, r, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 	w.Write(encodedData)
 }
 
+// marshalError answers 500 with a body that cannot fail to encode.
+func marshalError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "encode response", slog.Any("error", err))
+
+	response := APIResponse("Internal server error", http.StatusInternalServerError, "error", nil)
+	response.Meta.Message = i18n.T(r.Context(), response.Meta.Message)
+	response.Meta.RequestID = logging.RequestID(r.Context())
+
+	encodedData, _ := json.Marshal(response)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(encodedData)
+}
+
 func APIResponse(message string, code int, status string, data interface{}) ResponseFormatter {
 	meta := Meta{
 		Message: message,
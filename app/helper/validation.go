@@ -0,0 +1,193 @@
+package helper
+
+import (
+	"chi-app/app/i18n"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	id_translations "github.com/go-playground/validator/v10/translations/id"
+)
+
+// FieldError describes one invalid input field. Field is the name the
+// client sent, Code the failed rule, so clients can highlight the field
+// and pick their own wording if they want to.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+var validate = newValidator()
+
+var (
+	slugPattern     = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	amountPattern   = regexp.MustCompile(`^\d+(?:\.\d{1,2})?$`)
+	filenamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,254}$`)
+)
+
+// customRules are the rules this API adds on top of the validator
+// built-ins, with their messages per language.
+var customRules = []struct {
+	tag      string
+	fn       validator.Func
+	messages map[string]string
+}{
+	{"slug", isSlug, map[string]string{
+		i18n.English:    "{0} must be a valid slug",
+		i18n.Indonesian: "{0} harus berupa slug yang valid",
+	}},
+	{"currency", isCurrencyAmount, map[string]string{
+		i18n.English:    "{0} must be a positive amount with at most two decimals",
+		i18n.Indonesian: "{0} harus berupa nominal positif dengan maksimal dua angka desimal",
+	}},
+	{"safe_filename", isSafeFilename, map[string]string{
+		i18n.English:    "{0} must be a file name without paths or special characters",
+		i18n.Indonesian: "{0} harus berupa nama file tanpa path atau karakter khusus",
+	}},
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	// report fields under the name the client used rather than the Go
+	// field name
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form", "query", "uri"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+
+			if name != "" {
+				return name
+			}
+		}
+
+		return field.Name
+	})
+
+	registrations := map[string]func(*validator.Validate, ut.Translator) error{
+		i18n.English:    en_translations.RegisterDefaultTranslations,
+		i18n.Indonesian: id_translations.RegisterDefaultTranslations,
+	}
+
+	for lang, register := range registrations {
+		err := register(v, i18n.Translator(i18n.WithLanguage(context.Background(), lang)))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	for _, rule := range customRules {
+		err := v.RegisterValidation(rule.tag, rule.fn)
+		if err != nil {
+			panic(err)
+		}
+
+		for lang, message := range rule.messages {
+			err = v.RegisterTranslation(rule.tag, i18n.Translator(i18n.WithLanguage(context.Background(), lang)), registerMessage(rule.tag, message), translateMessage)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	return v
+}
+
+func registerMessage(tag string, message string) validator.RegisterTranslationsFunc {
+	return func(translator ut.Translator) error {
+		return translator.Add(tag, message, true)
+	}
+}
+
+func translateMessage(translator ut.Translator, fe validator.FieldError) string {
+	message, err := translator.T(fe.Tag(), fe.Field())
+	if err != nil {
+		return fe.Error()
+	}
+
+	return message
+}
+
+func isSlug(fl validator.FieldLevel) bool {
+	return slugPattern.MatchString(fl.Field().String())
+}
+
+// isCurrencyAmount accepts positive amounts. Integers are whole rupiah,
+// floats and strings may carry cents.
+func isCurrencyAmount(fl validator.FieldLevel) bool {
+	field := fl.Field()
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return field.Int() > 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint() > 0
+	case reflect.Float32, reflect.Float64:
+		cents := field.Float() * 100
+		return field.Float() > 0 && math.Abs(cents-math.Round(cents)) < 1e-6
+	case reflect.String:
+		if !amountPattern.MatchString(field.String()) {
+			return false
+		}
+
+		amount, err := strconv.ParseFloat(field.String(), 64)
+		return err == nil && amount > 0
+	}
+
+	return false
+}
+
+// isSafeFilename only allows plain names that cannot leave the directory
+// they are written to.
+func isSafeFilename(fl validator.FieldLevel) bool {
+	name := fl.Field().String()
+	return filenamePattern.MatchString(name) && !strings.Contains(name, "..")
+}
+
+func Validate(input interface{}) error {
+	return validate.Struct(input)
+}
+
+// FormatValidationErrors turns the error returned by Validate into one
+// FieldError per failed rule, with messages in the request language.
+func FormatValidationErrors(ctx context.Context, err error) []FieldError {
+	translator := i18n.Translator(ctx)
+
+	fieldErrors := []FieldError{}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return fieldErrors
+	}
+
+	for _, e := range validationErrors {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   fieldPath(e),
+			Code:    e.Tag(),
+			Message: e.Translate(translator),
+		})
+	}
+
+	return fieldErrors
+}
+
+// fieldPath drops the struct name from the namespace, so nested and
+// slice fields read like "scopes[0]".
+func fieldPath(e validator.FieldError) string {
+	namespace := e.Namespace()
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+
+	return e.Field()
+}
@@ -0,0 +1,138 @@
+// Package i18n picks the response language for a request and translates
+// API messages into it. Messages are keyed by their English text, so
+// untranslated messages simply fall back to English.
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/id"
+	ut "github.com/go-playground/universal-translator"
+)
+
+const (
+	English    = "en"
+	Indonesian = "id"
+
+	DefaultLanguage = English
+)
+
+var universal = newUniversalTranslator()
+
+func newUniversalTranslator() *ut.UniversalTranslator {
+	universal := ut.New(en.New(), en.New(), id.New())
+
+	translator, _ := universal.GetTranslator(Indonesian)
+	for message, translation := range indonesian {
+		err := translator.Add(message, translation, false)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return universal
+}
+
+type ctxKeyLanguage struct{}
+
+func WithLanguage(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, ctxKeyLanguage{}, lang)
+}
+
+func Language(ctx context.Context) string {
+	if lang, ok := ctx.Value(ctxKeyLanguage{}).(string); ok {
+		return lang
+	}
+
+	return DefaultLanguage
+}
+
+// Translator returns the universal-translator for the request language,
+// which also carries the validator messages.
+func Translator(ctx context.Context) ut.Translator {
+	translator, _ := universal.GetTranslator(Language(ctx))
+	return translator
+}
+
+// T translates message into the request language.
+func T(ctx context.Context, message string) string {
+	translation, err := Translator(ctx).T(message)
+	if err != nil || translation == "" {
+		return message
+	}
+
+	return translation
+}
+
+// Middleware stores the negotiated language in the request context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := Negotiate(r)
+
+		w.Header().Set("Content-Language", lang)
+		w.Header().Add("Vary", "Accept-Language")
+
+		next.ServeHTTP(w, r.WithContext(WithLanguage(r.Context(), lang)))
+	})
+}
+
+// Negotiate picks the language from the lang query parameter, meant for
+// testing, or else the best supported Accept-Language entry.
+func Negotiate(r *http.Request) string {
+	if lang, ok := supported(r.URL.Query().Get("lang")); ok {
+		return lang
+	}
+
+	type candidate struct {
+		lang    string
+		quality float64
+	}
+
+	candidates := []candidate{}
+	for _, entry := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ";")
+
+		quality := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				quality, _ = strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+			}
+		}
+
+		if lang, ok := supported(parts[0]); ok && quality > 0 {
+			candidates = append(candidates, candidate{lang, quality})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+
+	if len(candidates) > 0 {
+		return candidates[0].lang
+	}
+
+	return DefaultLanguage
+}
+
+// supported maps a language tag such as "id-ID" to one of the catalogs.
+// "in" is the withdrawn code for Indonesian that some clients still send.
+func supported(tag string) (string, bool) {
+	primary := strings.ToLower(strings.SplitN(strings.TrimSpace(tag), "-", 2)[0])
+	primary = strings.SplitN(primary, "_", 2)[0]
+
+	switch primary {
+	case English:
+		return English, true
+	case Indonesian, "in":
+		return Indonesian, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,51 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		target         string
+		acceptLanguage string
+		want           string
+	}{
+		{"/", "", English},
+		{"/", "id-ID,id;q=0.9,en-US;q=0.8", Indonesian},
+		{"/", "en-US,en;q=0.9,id;q=0.8", English},
+		{"/", "fr-FR, id;q=0.5", Indonesian},
+		{"/", "in", Indonesian},
+		{"/", "id;q=0, en;q=0.1", English},
+		{"/", "de, fr", English},
+		{"/?lang=id", "en", Indonesian},
+		{"/?lang=xx", "id", Indonesian},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, test.target, nil)
+		r.Header.Set("Accept-Language", test.acceptLanguage)
+
+		if got := Negotiate(r); got != test.want {
+			t.Errorf("Negotiate(%s, %q) = %q, want %q", test.target, test.acceptLanguage, got, test.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	ctx := WithLanguage(context.Background(), Indonesian)
+
+	if got := T(ctx, "campaign not found"); got != "kampanye tidak ditemukan" {
+		t.Errorf("got %q", got)
+	}
+
+	if got := T(ctx, "no translation for this"); got != "no translation for this" {
+		t.Errorf("untranslated message changed to %q", got)
+	}
+
+	if got := T(context.Background(), "campaign not found"); got != "campaign not found" {
+		t.Errorf("default language translated to %q", got)
+	}
+}
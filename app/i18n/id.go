@@ -0,0 +1,92 @@
+package i18n
+
+var indonesian = map[string]string{
+	// responses
+	"Account has been created":                             "Akun berhasil dibuat",
+	"API key has been created, it will not be shown again": "API key berhasil dibuat dan tidak akan ditampilkan lagi",
+	"API key has been revoked":                             "API key telah dicabut",
+	"Avatar successfully uploaded!":                        "Avatar berhasil diunggah!",
+	"Campaign image successfully uploaded":                 "Gambar kampanye berhasil diunggah",
+	"Detail Campaign":                                      "Detail kampanye",
+	"Duplicate request":                                    "Permintaan ganda",
+	"Failed check email":                                   "Gagal memeriksa email",
+	"Failed login user":                                    "Gagal masuk",
+	"Failed register user":                                 "Gagal mendaftarkan pengguna",
+	"Failed to confirm two-factor authentication":          "Gagal mengonfirmasi autentikasi dua faktor",
+	"Failed to create api key":                             "Gagal membuat API key",
+	"Failed to create campaign":                            "Gagal membuat kampanye",
+	"Failed to enroll two-factor authentication":           "Gagal mendaftarkan autentikasi dua faktor",
+	"Failed to get api keys":                               "Gagal mengambil daftar API key",
+	"Failed to get campaigns":                              "Gagal mengambil daftar kampanye",
+	"Failed to get detail campaign":                        "Gagal mengambil detail kampanye",
+	"Failed to get user profile":                           "Gagal mengambil profil pengguna",
+	"Failed to revoke api key":                             "Gagal mencabut API key",
+	"Failed to start login":                                "Gagal memulai proses masuk",
+	"Failed to unlock user":                                "Gagal membuka kunci pengguna",
+	"Failed to update campaign":                            "Gagal memperbarui kampanye",
+	"Failed update campaign":                               "Gagal memperbarui kampanye",
+	"Failed to upload avatar":                              "Gagal mengunggah avatar",
+	"Failed to upload campaign image":                      "Gagal mengunggah gambar kampanye",
+	"Forbidden":                                            "Akses ditolak",
+	"Internal server error":                                "Terjadi kesalahan pada server",
+	"Invalid idempotency key":                              "Idempotency key tidak valid",
+	"Invalid request body":                                 "Body request tidak valid",
+	"List of api keys":                                     "Daftar API key",
+	"List of campaigns":                                    "Daftar kampanye",
+	"Login Successfully":                                   "Berhasil masuk",
+	"Request body is too large":                            "Body request terlalu besar",
+	"Scan the QR code and confirm with a code":             "Pindai kode QR lalu konfirmasi dengan kode yang muncul",
+	"Service is healthy":                                   "Layanan berjalan normal",
+	"Service is not ready":                                 "Layanan belum siap",
+	"Service is ready":                                     "Layanan siap",
+	"Service unavailable":                                  "Layanan tidak tersedia",
+	"Success check available email":                        "Berhasil memeriksa ketersediaan email",
+	"Success to create campaign":                           "Berhasil membuat kampanye",
+	"Success to update campaign":                           "Berhasil memperbarui kampanye",
+	"Too many requests":                                    "Terlalu banyak permintaan",
+	"Two-factor authentication enabled, store the recovery codes safely": "Autentikasi dua faktor aktif, simpan kode pemulihan di tempat yang aman",
+	"Two-factor authentication required":                                 "Autentikasi dua faktor diperlukan",
+	"Unauthorized":                                                       "Tidak terautentikasi",
+	"Unknown login provider":                                             "Penyedia login tidak dikenal",
+	"User has been unlocked":                                             "Kunci pengguna telah dibuka",
+	"User profile":                                                       "Profil pengguna",
+	"Version":                                                            "Versi",
+
+	// error details
+	"api key has expired": "API key sudah kedaluwarsa",
+	"api key not found":   "API key tidak ditemukan",
+	"a request with this idempotency key is still being processed": "permintaan dengan idempotency key ini masih diproses",
+	"campaign has been changed since it was read":                  "kampanye sudah diubah sejak terakhir dibaca",
+	"campaign not found":                    "kampanye tidak ditemukan",
+	"challenge token has already been used": "token tantangan sudah digunakan",
+	"content type must be application/json, application/x-www-form-urlencoded or multipart/form-data": "Content-Type harus application/json, application/x-www-form-urlencoded atau multipart/form-data",
+	"email address has not been verified by the provider":                                             "alamat email belum diverifikasi oleh penyedia",
+	"email has already been registered":                                                               "email sudah terdaftar",
+	"email or password not match":                                                                     "email atau kata sandi tidak cocok",
+	"idempotency key has already been used for a different request":                                   "idempotency key sudah digunakan untuk permintaan lain",
+	"idempotency key must be 1 to 255 printable characters":                                           "idempotency key harus terdiri dari 1 sampai 255 karakter yang dapat dicetak",
+	"identity has already been linked":                                                                "identitas sudah ditautkan",
+	"invalid api key":                                                                                 "API key tidak valid",
+	"invalid challenge token":                                                                         "token tantangan tidak valid",
+	"invalid two-factor code":                                                                         "kode dua faktor tidak valid",
+	"login provider is unavailable":                                                                   "penyedia login sedang tidak tersedia",
+	"login with the provider failed":                                                                  "masuk melalui penyedia gagal",
+	"not an owner of the campaign":                                                                    "bukan pemilik kampanye",
+	"provider did not return a valid email address":                                                   "penyedia tidak mengembalikan alamat email yang valid",
+	"rate limit exceeded, please try again later":                                                     "batas permintaan terlampaui, silakan coba lagi nanti",
+	"recovery code has already been used":                                                             "kode pemulihan sudah digunakan",
+	"request body could not be read":                                                                  "body request tidak dapat dibaca",
+	"request body is too large":                                                                       "body request terlalu besar",
+	"request body must contain a single JSON object":                                                  "body request harus berisi satu objek JSON",
+	"request body must not be empty":                                                                  "body request tidak boleh kosong",
+	"something went wrong on our side, please try again":                                              "terjadi kesalahan di sisi kami, silakan coba lagi",
+	"the request was cancelled":                                                                       "permintaan dibatalkan",
+	"the request took too long, please try again":                                                     "permintaan terlalu lama, silakan coba lagi",
+	"the service is temporarily unavailable, please try again":                                        "layanan sedang tidak tersedia, silakan coba lagi",
+	"too many failed login attempts, try again later":                                                 "terlalu banyak percobaan masuk yang gagal, coba lagi nanti",
+	"two-factor authentication has not been enrolled":                                                 "autentikasi dua faktor belum didaftarkan",
+	"two-factor authentication is already enabled":                                                    "autentikasi dua faktor sudah aktif",
+	"two-factor authentication is not enabled":                                                        "autentikasi dua faktor belum aktif",
+	"two-factor code has already been used":                                                           "kode dua faktor sudah digunakan, tunggu kode berikutnya",
+	"user not found":                                                                                  "pengguna tidak ditemukan",
+}
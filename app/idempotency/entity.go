@@ -0,0 +1,25 @@
+package idempotency
+
+import (
+	"net/http"
+	"time"
+)
+
+// Record is the stored outcome of the first request sent with a key.
+// StatusCode stays zero while that request is still being handled. Header
+// keeps the validators and Location of the response.
+type Record struct {
+	UserID      int
+	Key         string
+	Fingerprint string
+	StatusCode  int
+	ContentType string
+	Header      http.Header
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+func (r Record) Completed() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,234 @@
+// Package idempotency makes POST and PUT requests safe to retry. A client
+// sends an Idempotency-Key header, the first response for that key and
+// user is stored, and a retry with the same key gets that response again
+// instead of running the handler a second time.
+package idempotency
+
+import (
+	"bytes"
+	"chi-app/app/helper"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+
+	// maxBodySize covers the largest upload, the body has to be read
+	// before the handler runs to fingerprint it
+	maxBodySize int64 = 8 << 20
+)
+
+// replayedHeaders are stored with the response besides Content-Type, a
+// replayed PUT or POST still tells the client the new version and where
+// the resource is.
+var replayedHeaders = []string{"ETag", "Last-Modified", "Location"}
+
+type Guard struct {
+	repository Repository
+	ttl        time.Duration
+	now        func() time.Time
+}
+
+// New keeps every key for ttl, a retry after that runs the request again.
+func New(repository Repository, ttl time.Duration) *Guard {
+	return &Guard{
+		repository: repository,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+// Middleware has to run after the auth middleware, keys belong to a user.
+// Requests without a key, without a user or with another method pass
+// through untouched. A key reused for a different request is rejected
+// with 422, a key whose first request is still running with 409.
+// Responses of 5xx are not stored, the client may retry those.
+func (g *Guard) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		idempotencyKey := r.Header.Get(Header)
+		authUser, ok := r.Context().Value(key.CtxKeyAuth{}).(user.User)
+
+		if idempotencyKey == "" || !ok || (r.Method != http.MethodPost && r.Method != http.MethodPut) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !validKey(idempotencyKey) {
+			helper.Error(w, r, "Invalid idempotency key", http.StatusBadRequest, "idempotency key must be 1 to 255 printable characters", nil)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			helper.Error(w, r, "Request body is too large", http.StatusRequestEntityTooLarge, helper.ErrBodyTooLarge.Error(), nil)
+			return
+		}
+
+		if err != nil {
+			helper.Error(w, r, "Invalid request body", http.StatusBadRequest, "request body could not be read", nil)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := g.now()
+		requestFingerprint := fingerprint(r, body)
+
+		record, claimed, err := g.repository.Claim(r.Context(), Record{
+			UserID:      authUser.ID,
+			Key:         idempotencyKey,
+			Fingerprint: requestFingerprint,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(g.ttl),
+		})
+		if err != nil {
+			slog.ErrorContext(r.Context(), "claim idempotency key", slog.Any("error", err))
+			w.Header().Set("Retry-After", "1")
+			helper.Error(w, r, "Service unavailable", http.StatusServiceUnavailable, "the service is temporarily unavailable, please try again", nil)
+			return
+		}
+
+		if !claimed {
+			g.answerDuplicate(w, r, record, requestFingerprint)
+			return
+		}
+
+		g.serve(w, r, next, record)
+	})
+}
+
+func (g *Guard) answerDuplicate(w http.ResponseWriter, r *http.Request, record Record, requestFingerprint string) {
+	switch {
+	case record.Fingerprint != requestFingerprint:
+		helper.Error(w, r, "Invalid idempotency key", http.StatusUnprocessableEntity, "idempotency key has already been used for a different request", nil)
+	case !record.Completed():
+		helper.Error(w, r, "Duplicate request", http.StatusConflict, "a request with this idempotency key is still being processed", nil)
+	default:
+		if record.ContentType != "" {
+			w.Header().Set("Content-Type", record.ContentType)
+		}
+
+		for _, name := range replayedHeaders {
+			if value := record.Header.Get(name); value != "" {
+				w.Header().Set(name, value)
+			}
+		}
+
+		w.Header().Set(ReplayedHeader, "true")
+		w.WriteHeader(record.StatusCode)
+		w.Write(record.Body)
+	}
+}
+
+// serve runs the handler for a claimed key and stores what it answered.
+// The key is released when the handler fails or panics, so the retry is
+// not stuck behind a 409 until the key expires.
+func (g *Guard) serve(w http.ResponseWriter, r *http.Request, next http.Handler, record Record) {
+	// the request may have timed out by the time the record is saved
+	ctx := context.WithoutCancel(r.Context())
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+
+		err := g.repository.Release(ctx, record.UserID, record.Key)
+		if err != nil {
+			slog.ErrorContext(ctx, "release idempotency key", slog.Any("error", err))
+		}
+	}()
+
+	body := &bytes.Buffer{}
+	ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	ww.Tee(body)
+
+	next.ServeHTTP(ww, r)
+
+	record.StatusCode = ww.Status()
+	if record.StatusCode == 0 {
+		record.StatusCode = http.StatusOK
+	}
+
+	if record.StatusCode >= http.StatusInternalServerError {
+		return
+	}
+
+	record.ContentType = ww.Header().Get("Content-Type")
+	record.Header = http.Header{}
+	for _, name := range replayedHeaders {
+		if value := ww.Header().Get(name); value != "" {
+			record.Header.Set(name, value)
+		}
+	}
+
+	record.Body = body.Bytes()
+
+	err := g.repository.Complete(ctx, record)
+	if err != nil {
+		slog.ErrorContext(ctx, "store idempotent response", slog.Any("error", err))
+		return
+	}
+
+	completed = true
+}
+
+// Run deletes the expired keys every hour until ctx is done.
+func (g *Guard) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := g.repository.DeleteExpired(ctx, g.now())
+			if err != nil {
+				slog.ErrorContext(ctx, "delete expired idempotency keys", slog.Any("error", err))
+				continue
+			}
+
+			slog.DebugContext(ctx, "deleted expired idempotency keys", slog.Int64("count", deleted))
+		}
+	}
+}
+
+// fingerprint ties a key to the request it was first sent with, query
+// parameters and the If-Match precondition included.
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n"+r.Header.Get("Content-Type")+"\n"+r.Header.Get("If-Match")+"\n")
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func validKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+
+	for _, c := range key {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
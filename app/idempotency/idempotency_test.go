@@ -0,0 +1,223 @@
+package idempotency
+
+import (
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func newGuard(t *testing.T) (*Guard, user.User) {
+	t.Helper()
+
+	db := databasetest.NewSQLite(t)
+
+	owner, err := user.NewUserRepository(db).Save(context.Background(), user.User{Name: "Budi", Email: "budi@example.com", Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(NewIdempotencyRepository(db), time.Hour), owner
+}
+
+func newRequest(owner user.User, idempotencyKey, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/campaigns", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(Header, idempotencyKey)
+
+	return r.WithContext(context.WithValue(r.Context(), key.CtxKeyAuth{}, owner))
+}
+
+func TestReplay(t *testing.T) {
+	guard, owner := newGuard(t)
+
+	var calls int32
+	handler := guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", fmt.Sprintf(`W/"%d"`, n))
+		w.Header().Set("Last-Modified", "Mon, 19 Oct 2026 08:00:00 GMT")
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/campaigns/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":%d}`, n)
+	}))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, newRequest(owner, "create-1", `{"name":"Sedekah"}`))
+
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, newRequest(owner, "create-1", `{"name":"Sedekah"}`))
+
+	if calls != 1 {
+		t.Fatalf("handler ran %d times", calls)
+	}
+
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get(ReplayedHeader) != "true" {
+		t.Fatalf("retry got %d %q %v, want the first response replayed", retry.Code, retry.Body.String(), retry.Header())
+	}
+
+	for _, name := range []string{"ETag", "Last-Modified", "Location"} {
+		if got, want := retry.Header().Get(name), first.Header().Get(name); got != want {
+			t.Fatalf("replayed %s: got %q, want %q", name, got, want)
+		}
+	}
+
+	reused := httptest.NewRecorder()
+	handler.ServeHTTP(reused, newRequest(owner, "create-1", `{"name":"Zakat"}`))
+
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused for another body: got %d", reused.Code)
+	}
+
+	withQuery := newRequest(owner, "create-1", `{"name":"Sedekah"}`)
+	withQuery.URL.RawQuery = "draft=true"
+
+	reused = httptest.NewRecorder()
+	handler.ServeHTTP(reused, withQuery)
+
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with other query parameters: got %d", reused.Code)
+	}
+
+	withPrecondition := newRequest(owner, "create-1", `{"name":"Sedekah"}`)
+	withPrecondition.Header.Set("If-Match", `W/"1"`)
+
+	reused = httptest.NewRecorder()
+	handler.ServeHTTP(reused, withPrecondition)
+
+	if reused.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with another If-Match: got %d", reused.Code)
+	}
+
+	other := httptest.NewRecorder()
+	handler.ServeHTTP(other, newRequest(owner, "create-2", `{"name":"Sedekah"}`))
+
+	if calls != 2 || other.Code != http.StatusCreated {
+		t.Fatalf("a new key did not run the handler: %d calls, status %d", calls, other.Code)
+	}
+}
+
+func TestUnreadableBody(t *testing.T) {
+	guard, owner := newGuard(t)
+
+	handler := guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran for an unreadable body")
+	}))
+
+	tooLarge := httptest.NewRecorder()
+	handler.ServeHTTP(tooLarge, newRequest(owner, "large", strings.Repeat("a", int(maxBodySize)+1)))
+
+	if tooLarge.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body over the limit: got %d, want %d", tooLarge.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	broken := newRequest(owner, "broken", "")
+	broken.Body = io.NopCloser(iotest.ErrReader(errors.New("connection reset")))
+
+	failed := httptest.NewRecorder()
+	handler.ServeHTTP(failed, broken)
+
+	if failed.Code != http.StatusBadRequest || strings.Contains(failed.Body.String(), "idempotency key") {
+		t.Fatalf("body that failed to read: got %d %s", failed.Code, failed.Body.String())
+	}
+}
+
+func TestConcurrentDuplicate(t *testing.T) {
+	guard, owner := newGuard(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	handler := guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest(owner, "create-1", `{}`))
+	}()
+
+	<-started
+
+	duplicate := httptest.NewRecorder()
+	handler.ServeHTTP(duplicate, newRequest(owner, "create-1", `{}`))
+
+	close(release)
+	<-done
+
+	if duplicate.Code != http.StatusConflict {
+		t.Fatalf("concurrent duplicate got %d, want 409", duplicate.Code)
+	}
+}
+
+func TestServerErrorReleasesKey(t *testing.T) {
+	guard, owner := newGuard(t)
+
+	status := http.StatusInternalServerError
+	handler := guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(owner, "create-1", `{}`))
+
+	status = http.StatusCreated
+	retry := httptest.NewRecorder()
+	handler.ServeHTTP(retry, newRequest(owner, "create-1", `{}`))
+
+	if retry.Code != http.StatusCreated || retry.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("retry after a 500 got %d %v, want the handler to run again", retry.Code, retry.Header())
+	}
+}
+
+func TestExpiredKey(t *testing.T) {
+	guard, owner := newGuard(t)
+
+	now := time.Now()
+	guard.now = func() time.Time { return now }
+
+	var calls int
+	handler := guard.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(owner, "create-1", `{}`))
+
+	now = now.Add(2 * time.Hour)
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest(owner, "create-1", `{}`))
+
+	if calls != 2 {
+		t.Fatalf("handler ran %d times, the expired key should run it again", calls)
+	}
+
+	deleted, err := guard.repository.DeleteExpired(context.Background(), now.Add(2*time.Hour))
+	if err != nil || deleted != 1 {
+		t.Fatalf("deleted %d expired keys: %v", deleted, err)
+	}
+}
+
+func TestClaimFailure(t *testing.T) {
+	db := databasetest.NewSQLite(t)
+	repository := NewIdempotencyRepository(db)
+
+	db.Close()
+
+	// a failed insert is not a taken key
+	_, claimed, err := repository.Claim(context.Background(), Record{UserID: 1, Key: "create-1", ExpiresAt: time.Now().Add(time.Hour)})
+	if err == nil || claimed {
+		t.Fatalf("claim on a closed database: got claimed %v, err %v", claimed, err)
+	}
+}
@@ -0,0 +1,187 @@
+package idempotency
+
+import (
+	"chi-app/app/tracing"
+	"chi-app/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type Repository interface {
+	Claim(ctx context.Context, record Record) (Record, bool, error)
+	Find(ctx context.Context, userID int, key string) (Record, error)
+	Complete(ctx context.Context, record Record) error
+	Release(ctx context.Context, userID int, key string) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type repository struct {
+	DB *database.DB
+}
+
+func NewIdempotencyRepository(DB *database.DB) Repository {
+	return &repository{DB}
+}
+
+// Claim inserts record unless its key is taken. The primary key on
+// user_id and idempotency_key decides between concurrent requests, the
+// loser gets the record of the winner and false. An expired record is
+// deleted first, its key is free again. Other insert failures are
+// returned as they are.
+func (r *repository) Claim(ctx context.Context, record Record) (Record, bool, error) {
+	ctx, span := tracing.Start(ctx, "idempotency.Repository.Claim")
+	defer span.End()
+
+	sqlDelete := r.DB.Builder().Delete("idempotency_keys").
+		Where(sq.Eq{"user_id": record.UserID, "idempotency_key": record.Key}).
+		Where(sq.LtOrEq{"expires_at": record.CreatedAt.UTC()}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlDelete.ExecContext(ctx)
+	if err != nil {
+		return record, false, err
+	}
+
+	sqlInsert := r.DB.Builder().Insert("idempotency_keys").
+		Columns(
+			"user_id",
+			"idempotency_key",
+			"fingerprint",
+			"created_at",
+			"expires_at").
+		Values(
+			record.UserID,
+			record.Key,
+			record.Fingerprint,
+			record.CreatedAt.UTC(),
+			record.ExpiresAt.UTC()).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err = sqlInsert.ExecContext(ctx)
+	if !database.IsUniqueViolation(err) {
+		return record, err == nil, err
+	}
+
+	existing, err := r.Find(ctx, record.UserID, record.Key)
+	if err != nil {
+		return record, false, err
+	}
+
+	// the winner failed and released the key in between, the caller
+	// answers as for a request still running and the client retries
+	if existing.Key == "" {
+		return record, false, nil
+	}
+
+	return existing, false, nil
+}
+
+// Find returns the zero Record when there is none for the key.
+func (r *repository) Find(ctx context.Context, userID int, key string) (Record, error) {
+	ctx, span := tracing.Start(ctx, "idempotency.Repository.Find")
+	defer span.End()
+
+	record := Record{}
+
+	sqlQuery := r.DB.Builder().Select(
+		"user_id",
+		"idempotency_key",
+		"fingerprint",
+		"status_code",
+		"content_type",
+		"headers",
+		"body",
+		"created_at",
+		"expires_at").
+		From("idempotency_keys").
+		Where(sq.Eq{"user_id": userID, "idempotency_key": key})
+
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
+	if err != nil {
+		return record, err
+	}
+
+	defer rows.Close()
+
+	if rows.Next() {
+		var headers sql.NullString
+
+		err := rows.Scan(
+			&record.UserID,
+			&record.Key,
+			&record.Fingerprint,
+			&record.StatusCode,
+			&record.ContentType,
+			&headers,
+			&record.Body,
+			&record.CreatedAt,
+			&record.ExpiresAt,
+		)
+
+		if err != nil {
+			return record, err
+		}
+
+		if headers.Valid {
+			err := json.Unmarshal([]byte(headers.String), &record.Header)
+			if err != nil {
+				return record, err
+			}
+		}
+	}
+
+	return record, rows.Err()
+}
+
+func (r *repository) Complete(ctx context.Context, record Record) error {
+	ctx, span := tracing.Start(ctx, "idempotency.Repository.Complete")
+	defer span.End()
+
+	headers, err := json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+
+	sqlQuery := r.DB.Builder().Update("idempotency_keys").
+		Set("status_code", record.StatusCode).
+		Set("content_type", record.ContentType).
+		Set("headers", string(headers)).
+		Set("body", record.Body).
+		Where(sq.Eq{"user_id": record.UserID, "idempotency_key": record.Key}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err = sqlQuery.ExecContext(ctx)
+	return err
+}
+
+func (r *repository) Release(ctx context.Context, userID int, key string) error {
+	ctx, span := tracing.Start(ctx, "idempotency.Repository.Release")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Delete("idempotency_keys").
+		Where(sq.Eq{"user_id": userID, "idempotency_key": key}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlQuery.ExecContext(ctx)
+	return err
+}
+
+func (r *repository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "idempotency.Repository.DeleteExpired")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Delete("idempotency_keys").
+		Where(sq.LtOrEq{"expires_at": now.UTC()}).
+		RunWith(r.DB.Runner(ctx))
+
+	result, err := sqlQuery.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -1,3 +1,5 @@
 package key
 
 type CtxKeyAuth struct{}
+
+type CtxKeyAPIKey struct{}
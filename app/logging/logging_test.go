@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"bytes"
+	"chi-app/config"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	defaultLogger := slog.Default()
+	slog.SetDefault(New(config.Log{Level: "info", Format: "json"}, buf))
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+	})
+
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+		slog.InfoContext(r.Context(), "login", slog.String("password", "hunter2"))
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/users/1?token=abc", nil)
+	r.Header.Set(RequestIDHeader, "upstream-42")
+	r.Header.Set("Authorization", "Bearer abc")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, r)
+
+	if seen != "upstream-42" || w.Header().Get(RequestIDHeader) != "upstream-42" {
+		t.Fatalf("request id not propagated: context %q, header %q", seen, w.Header().Get(RequestIDHeader))
+	}
+
+	if strings.Contains(buf.String(), "hunter2") || strings.Contains(buf.String(), "abc") {
+		t.Fatalf("secret in logs: %s", buf.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2: %s", len(lines), buf.String())
+	}
+
+	for _, line := range lines {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+
+		if record["request_id"] != "upstream-42" {
+			t.Errorf("line without request id: %s", line)
+		}
+	}
+
+	access := map[string]interface{}{}
+	json.Unmarshal([]byte(lines[1]), &access)
+	if access["level"] != "WARN" || access["status"] != float64(http.StatusUnauthorized) || access["path"] != "/api/v1/users/1" {
+		t.Errorf("unexpected access log: %s", lines[1])
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, incoming := range []string{"", "bad id\nwith newline", strings.Repeat("a", 65)} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(RequestIDHeader, incoming)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, r)
+
+		id := w.Header().Get(RequestIDHeader)
+		if len(id) != 32 || id == incoming {
+			t.Errorf("incoming %q: got id %q, want a generated one", incoming, id)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package metrics exposes Prometheus metrics on GET /metrics: request
+// counts and latencies per chi route pattern, connection pool stats and
+// business counters.
+package metrics
+
+import (
+	"chi-app/app/helper"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "chi_campaign"
+
+// login methods and results used as label values
+const (
+	LoginPassword  = "password"
+	LoginTwoFactor = "two_factor"
+	LoginOIDC      = "oidc"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+
+	Registrations    prometheus.Counter
+	Logins           *prometheus.CounterVec
+	CampaignsCreated prometheus.Counter
+}
+
+// New uses its own registry, so tests can create as many as they like.
+func New() *Metrics {
+	m := &Metrics{registry: prometheus.NewRegistry()}
+
+	m.requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	m.duration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	m.Registrations = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_registrations_total",
+		Help:      "Accounts created.",
+	})
+
+	m.Logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_logins_total",
+		Help:      "Login attempts by method and result.",
+	}, []string{"method", "result"})
+
+	m.CampaignsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "campaigns_created_total",
+		Help:      "Campaigns created.",
+	})
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.duration,
+		m.Registrations,
+		m.Logins,
+		m.CampaignsCreated,
+	)
+
+	return m
+}
+
+// RegisterDB exports the sql.DBStats of db as go_sql_* gauges.
+func (m *Metrics) RegisterDB(name string, db *sql.DB) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the registry to scrapers sending token as a bearer
+// token. The metrics name every route and tell how busy the service is,
+// so they are not public.
+func (m *Metrics) Handler(token string) http.Handler {
+	scrape := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+	want := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if token == "" || subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			helper.Error(w, r, "Unauthorized", http.StatusUnauthorized, nil, nil)
+			return
+		}
+
+		scrape.ServeHTTP(w, r)
+	})
+}
+
+// Middleware records every request under its route pattern rather than
+// the raw path, so /campaigns/1 and /campaigns/2 share one series.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := routePattern(r)
+
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.duration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routePattern is read after the request was routed, unmatched paths are
+// grouped to keep the label set bounded.
+func routePattern(r *http.Request) string {
+	routeCtx := chi.RouteContext(r.Context())
+	if routeCtx == nil {
+		return "unmatched"
+	}
+
+	pattern := routeCtx.RoutePattern()
+	if pattern == "" {
+		return "unmatched"
+	}
+
+	return pattern
+}
+
+func (m *Metrics) login(method string, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+
+	m.Logins.WithLabelValues(method, result).Inc()
+}
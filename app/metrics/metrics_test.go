@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"chi-app/app/user"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMiddlewareLabelsByRoutePattern(t *testing.T) {
+	m := New()
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("ok"))
+		})
+	})
+
+	for _, path := range []string{"/api/v1/campaigns/1", "/api/v1/campaigns/2", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("GET", "/api/v1/campaigns/{id}", "200")); got != 2 {
+		t.Errorf("got %v requests for the campaign route, want 2", got)
+	}
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("GET", "unmatched", "404")); got != 1 {
+		t.Errorf("got %v unmatched requests, want 1", got)
+	}
+
+	scrape := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	scrape.Header.Set("Authorization", "Bearer secret")
+
+	w := httptest.NewRecorder()
+	m.Handler("secret").ServeHTTP(w, scrape)
+
+	body, _ := io.ReadAll(w.Body)
+	for _, want := range []string{
+		`chi_campaign_http_request_duration_seconds_count{method="GET",route="/api/v1/campaigns/{id}"} 2`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("scrape does not contain %q", want)
+		}
+	}
+}
+
+func TestHandlerRequiresToken(t *testing.T) {
+	m := New()
+
+	for _, authorization := range []string{"", "Bearer wrong", "secret", "Bearer secret2"} {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+
+		w := httptest.NewRecorder()
+		m.Handler("secret").ServeHTTP(w, r)
+
+		if w.Code != http.StatusUnauthorized || strings.Contains(w.Body.String(), "go_goroutines") {
+			t.Errorf("authorization %q: got status %d, want %d", authorization, w.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// an empty token never matches, not even an empty bearer
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Authorization", "Bearer ")
+
+	w := httptest.NewRecorder()
+	m.Handler("").ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("empty token: got status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestUserServiceCounters(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+
+	policy := user.DefaultSecurityPolicy()
+	policy.BcryptCost = bcrypt.MinCost
+
+	service := NewUserService(user.NewUserService(user.NewMemoryUserRepository(), nil, policy), m)
+
+	_, err := service.RegisterUser(ctx, user.RegisterUserInput{Name: "Budi", Occupation: "Developer", Email: "budi@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	_, err = service.RegisterUser(ctx, user.RegisterUserInput{Name: "Budi", Occupation: "Developer", Email: "budi@example.com", Password: "secret"})
+	if err == nil {
+		t.Fatal("registered the same email twice")
+	}
+
+	service.LoginUser(ctx, user.LoginUserInput{Email: "budi@example.com", Password: "secret", IPAddress: "10.0.0.1"})
+	service.LoginUser(ctx, user.LoginUserInput{Email: "budi@example.com", Password: "wrong", IPAddress: "10.0.0.1"})
+
+	if got := testutil.ToFloat64(m.Registrations); got != 1 {
+		t.Errorf("got %v registrations, want 1", got)
+	}
+
+	if got := testutil.ToFloat64(m.Logins.WithLabelValues(LoginPassword, ResultSuccess)); got != 1 {
+		t.Errorf("got %v successful logins, want 1", got)
+	}
+
+	if got := testutil.ToFloat64(m.Logins.WithLabelValues(LoginPassword, ResultFailure)); got != 1 {
+		t.Errorf("got %v failed logins, want 1", got)
+	}
+}
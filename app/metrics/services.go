@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"chi-app/app/campaign"
+	"chi-app/app/user"
+	"context"
+)
+
+// userService counts registrations and logins, every other method goes
+// straight to the wrapped service.
+type userService struct {
+	user.Service
+	metrics *Metrics
+}
+
+func NewUserService(service user.Service, metrics *Metrics) user.Service {
+	return &userService{service, metrics}
+}
+
+func (s *userService) RegisterUser(ctx context.Context, input user.RegisterUserInput) (user.User, error) {
+	newUser, err := s.Service.RegisterUser(ctx, input)
+	if err == nil {
+		s.metrics.Registrations.Inc()
+	}
+
+	return newUser, err
+}
+
+func (s *userService) LoginUser(ctx context.Context, input user.LoginUserInput) (user.User, error) {
+	loggedInUser, err := s.Service.LoginUser(ctx, input)
+	s.metrics.login(LoginPassword, err)
+
+	return loggedInUser, err
+}
+
+func (s *userService) VerifyTwoFactor(ctx context.Context, input user.VerifyTwoFactorInput) (user.User, error) {
+	loggedInUser, err := s.Service.VerifyTwoFactor(ctx, input)
+	s.metrics.login(LoginTwoFactor, err)
+
+	return loggedInUser, err
+}
+
+func (s *userService) LoginWithIdentity(ctx context.Context, input user.SocialLoginInput) (user.User, error) {
+	loggedInUser, err := s.Service.LoginWithIdentity(ctx, input)
+	s.metrics.login(LoginOIDC, err)
+
+	return loggedInUser, err
+}
+
+type campaignService struct {
+	campaign.Service
+	metrics *Metrics
+}
+
+func NewCampaignService(service campaign.Service, metrics *Metrics) campaign.Service {
+	return &campaignService{service, metrics}
+}
+
+func (s *campaignService) CreateCampaign(ctx context.Context, input campaign.CreateCampaignInput) (campaign.Campaign, error) {
+	newCampaign, err := s.Service.CreateCampaign(ctx, input)
+	if err == nil {
+		s.metrics.CampaignsCreated.Inc()
+	}
+
+	return newCampaign, err
+}
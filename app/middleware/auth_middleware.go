@@ -1,28 +1,156 @@
 package middleware
 
 import (
+	"chi-app/app/apikey"
+	"chi-app/app/apperror"
+	"chi-app/app/auth"
+	"chi-app/app/handler"
 	"chi-app/app/helper"
-	"fmt"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"context"
+	"errors"
 	"net/http"
 	"strings"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("authorization")
+// AuthMiddleware accepts either a Bearer JWT or a personal API key in the
+// X-API-Key header. In both cases the owning user is stored in the request
+// context; for API keys the key itself is stored as well so RequireScope
+// can check what it is allowed to do.
+func AuthMiddleware(authService auth.Service, userService user.Service, apiKeyService apikey.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if plainKey := r.Header.Get("X-API-Key"); plainKey != "" {
+				apiKey, err := apiKeyService.Authenticate(ctx, plainKey)
+				if err != nil {
+					authenticationFailed(w, r, err)
+					return
+				}
+
+				user, err := userService.GetUserByID(ctx, apiKey.UserID)
+				if err != nil {
+					authenticationFailed(w, r, err)
+					return
+				}
+
+				ctx = context.WithValue(ctx, key.CtxKeyAuth{}, user)
+				ctx = context.WithValue(ctx, key.CtxKeyAPIKey{}, apiKey)
+
+				// next to route
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			authHeader := r.Header.Get("authorization")
+
+			if !strings.Contains(authHeader, "Bearer") {
+				unauthorized(w, r)
+				return
+			}
+
+			tokenString := ""
+			arrayToken := strings.Split(authHeader, " ")
+			if len(arrayToken) == 2 {
+				tokenString = arrayToken[1]
+			}
+
+			token, err := authService.ValidateToken(tokenString)
+			if err != nil {
+				unauthorized(w, r)
+				return
+			}
+
+			// challenge tokens from a half finished two-factor login carry a
+			// purpose claim and must not grant access
+			claim, ok := token.Claims.(jwt.MapClaims)
+			if !ok || !token.Valid || claim["purpose"] != nil {
+				unauthorized(w, r)
+				return
+			}
+
+			userID, ok := claim["user_id"].(float64)
+			if !ok {
+				unauthorized(w, r)
+				return
+			}
+
+			user, err := userService.GetUserByID(ctx, int(userID))
+			if err != nil {
+				authenticationFailed(w, r, err)
+				return
+			}
+
+			ctx = context.WithValue(ctx, key.CtxKeyAuth{}, user)
+
+			// next to route
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
 
-		if !strings.Contains(authHeader, "Bearer") {
-			response := helper.APIResponse("Unauthorized", http.StatusUnauthorized, "error", nil)
-			helper.JSON(w, response, http.StatusUnauthorized)
+// RequireScope lets interactive sessions through and restricts API keys to
+// the given scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, ok := r.Context().Value(key.CtxKeyAPIKey{}).(apikey.APIKey)
+			if ok && !apiKey.HasScope(scope) {
+				forbidden(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SessionOnly rejects API keys on routes that need a logged in human, such
+// as managing API keys or two-factor settings.
+func SessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Value(key.CtxKeyAPIKey{}).(apikey.APIKey)
+		if ok {
+			forbidden(w, r)
 			return
 		}
 
-		tokenString := ""
-		arrayToken := strings.Split(authHeader, " ")
-		if len(arrayToken) == 2 {
-			tokenString = arrayToken[1]
+		next.ServeHTTP(w, r)
+	})
+}
+
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(key.CtxKeyAuth{}).(user.User)
+		if !ok || user.Role != "admin" {
+			forbidden(w, r)
+			return
 		}
 
-		fmt.Println(tokenString)
+		next.ServeHTTP(w, r)
 	})
 }
+
+// authenticationFailed answers 401 only for credentials that do not check
+// out. Other errors, such as an unreachable database, are not the client's
+// fault and get the status the handlers answer them with.
+func authenticationFailed(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, apikey.ErrInvalidKey) || errors.Is(err, apikey.ErrExpiredKey) || errors.Is(err, apperror.ErrNotFound) {
+		unauthorized(w, r)
+		return
+	}
+
+	handler.RespondError(w, r, "Unauthorized", err)
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	helper.Error(w, r, "Unauthorized", http.StatusUnauthorized, nil, nil)
+}
+
+func forbidden(w http.ResponseWriter, r *http.Request) {
+	helper.Error(w, r, "Forbidden", http.StatusForbidden, nil, nil)
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"chi-app/app/apikey"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubAPIKeyService fails every authentication with err.
+type stubAPIKeyService struct {
+	apikey.Service
+	err error
+}
+
+func (s stubAPIKeyService) Authenticate(ctx context.Context, plainKey string) (apikey.APIKey, error) {
+	return apikey.APIKey{}, s.err
+}
+
+func TestAuthMiddlewareErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{apikey.ErrInvalidKey, http.StatusUnauthorized},
+		{apikey.ErrExpiredKey, http.StatusUnauthorized},
+		{driver.ErrBadConn, http.StatusServiceUnavailable},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+	}
+
+	for _, test := range tests {
+		handler := AuthMiddleware(nil, nil, stubAPIKeyService{err: test.err})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("%v: reached the handler", test.err)
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/users/fetch", nil)
+		r.Header.Set("X-API-Key", "ck_0000_secret")
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.want {
+			t.Errorf("%v: got status %d, want %d", test.err, w.Code, test.want)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(apikey.ScopeCampaignsWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		apiKey *apikey.APIKey
+		want   int
+	}{
+		{"session", nil, http.StatusOK},
+		{"key with scope", &apikey.APIKey{Scopes: []string{apikey.ScopeCampaignsWrite}}, http.StatusOK},
+		{"key without scope", &apikey.APIKey{Scopes: []string{}}, http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		ctx := context.WithValue(context.Background(), key.CtxKeyAuth{}, user.User{ID: 1})
+		if test.apiKey != nil {
+			ctx = context.WithValue(ctx, key.CtxKeyAPIKey{}, *test.apiKey)
+		}
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/campaigns", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, r)
+
+		if w.Code != test.want {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"chi-app/app/helper"
+	"chi-app/config"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressibleTypes are the content types worth compressing, uploaded
+// images are compressed already.
+var compressibleTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/msgpack",
+	"text/",
+	"image/svg+xml",
+}
+
+// Compress encodes responses with the first configured encoding the
+// client accepts. The body is held back until it reaches the minimum
+// size, smaller bodies go out as they are. Handlers that set their own
+// Content-Encoding, partial content and responses without a body are left
+// alone. A compressed response has the encoding added to its ETag.
+func Compress(cfg config.Compression) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(cfg.Encodings) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), cfg.Encodings)
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: cfg.MinSize, ifNoneMatch: r.Header.Get("If-None-Match")}
+			next.ServeHTTP(cw, r)
+
+			// not deferred, after a panic the recoverer still has to be
+			// able to answer 500 instead of a half written body
+			cw.Close()
+		})
+	}
+}
+
+// negotiateEncoding returns the first of encodings that Accept-Encoding
+// allows with the highest quality, or "" for none.
+func negotiateEncoding(acceptEncoding string, encodings []string) string {
+	qualities := map[string]float64{}
+	for _, accepted := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(accepted), ";")
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		qualities[strings.ToLower(name)] = quality
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range encodings {
+		quality, ok := qualities[encoding]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+
+		if ok && quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+
+	return best
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	ifNoneMatch string
+
+	status  int
+	buf     []byte
+	started bool
+	encoder io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.started || cw.status != 0 {
+		return
+	}
+
+	// informational responses are not the final status
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.status = status
+	if !bodyAllowed(status) || cw.Header().Get("Content-Encoding") != "" || cw.Header().Get("Content-Range") != "" {
+		cw.start(false)
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.started {
+		if cw.encoder != nil {
+			return cw.encoder.Write(p)
+		}
+
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize {
+		cw.start(true)
+	}
+
+	return len(p), nil
+}
+
+// start sends the header and what was held back, compressed when asked
+// for and the content type is worth it.
+func (cw *compressWriter) start(compress bool) {
+	cw.started = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	header := cw.Header()
+	if header.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	etag := header.Get("ETag")
+	if compress && compressible(header.Get("Content-Type")) {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		if etag != "" {
+			header.Set("ETag", helper.EncodedETag(etag, cw.encoding))
+		}
+
+		switch cw.encoding {
+		case "br":
+			cw.encoder = brotli.NewWriterLevel(cw.ResponseWriter, brotli.DefaultCompression)
+		case "gzip":
+			cw.encoder = gzip.NewWriter(cw.ResponseWriter)
+		}
+	} else if cw.status == http.StatusNotModified && etag != "" && cw.heldEncoded(etag) {
+		// a 304 carries the tag of the response the client kept
+		header.Set("ETag", helper.EncodedETag(etag, cw.encoding))
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) > 0 {
+		cw.Write(buf)
+	}
+}
+
+// Flush sends what was held back, a handler flushing wants its client
+// to see the response now rather than when it is large enough.
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(true)
+	}
+
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the response, a body that never reached the minimum
+// size is sent uncompressed.
+func (cw *compressWriter) Close() {
+	if !cw.started {
+		cw.start(false)
+	}
+
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
+
+// heldEncoded reports whether If-None-Match names the compressed
+// response tagged from etag.
+func (cw *compressWriter) heldEncoded(etag string) bool {
+	encoded := strings.TrimPrefix(helper.EncodedETag(etag, cw.encoding), "W/")
+	for _, candidate := range helper.ETags(cw.ifNoneMatch) {
+		if strings.TrimPrefix(candidate, "W/") == encoded {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && status != http.StatusPartialContent
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, compressibleType := range compressibleTypes {
+		if mediaType == compressibleType || strings.HasSuffix(compressibleType, "/") && strings.HasPrefix(mediaType, compressibleType) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"chi-app/app/helper"
+	"chi-app/config"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"name":"campaign"}`, 200)
+
+	handler := Compress(config.Default().Compression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(large))
+		case "/not-modified":
+			w.WriteHeader(http.StatusNotModified)
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			// written in pieces, the threshold is on the whole body
+			for i := 0; i < len(large); i += 100 {
+				w.Write([]byte(large[i:min(i+100, len(large))]))
+			}
+		}
+	}))
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{"/", "gzip, deflate, br", "br"},
+		{"/", "gzip", "gzip"},
+		{"/", "br;q=0.5, gzip", "gzip"},
+		{"/", "br;q=0, *", "gzip"},
+		{"/", "identity", ""},
+		{"/", "", ""},
+		{"/small", "br, gzip", ""},
+		{"/image", "br, gzip", ""},
+		{"/not-modified", "br, gzip", ""},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Encoding"); got != test.wantEncoding {
+			t.Fatalf("%s with Accept-Encoding %q: got Content-Encoding %q, want %q", test.path, test.acceptEncoding, got, test.wantEncoding)
+		}
+
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Fatalf("%s: got Vary %q, want Accept-Encoding", test.path, got)
+		}
+
+		var body io.Reader = w.Body
+		switch test.wantEncoding {
+		case "br":
+			body = brotli.NewReader(w.Body)
+		case "gzip":
+			gzipReader, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("%s: read gzip: %v", test.path, err)
+			}
+
+			body = gzipReader
+		}
+
+		decoded, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%s with Accept-Encoding %q: decode body: %v", test.path, test.acceptEncoding, err)
+		}
+
+		if test.path == "/" && (string(decoded) != large || w.Code != http.StatusCreated) {
+			t.Fatalf("%s with Accept-Encoding %q: got status %d and %d bytes, want %d and %d bytes", test.path, test.acceptEncoding, w.Code, len(decoded), http.StatusCreated, len(large))
+		}
+	}
+}
+
+func TestCompressDisabled(t *testing.T) {
+	handler := Compress(config.Compression{MinSize: 0})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Header().Get("Content-Encoding") != "" || w.Header().Get("Vary") != "" {
+		t.Fatalf("got headers %v, want no compression without encodings", w.Header())
+	}
+}
+
+func TestCompressConditional(t *testing.T) {
+	large := strings.Repeat(`{"name":"campaign"}`, 200)
+
+	handler := Compress(config.Default().Compression)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if helper.NotModified(w, r, helper.WeakETag("v1"), time.Time{}) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(large))
+	}))
+
+	get := func(acceptEncoding string, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		return w
+	}
+
+	// the compressed bytes get a tag of their own
+	w := get("gzip", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" || etag != `W/"v1-gzip"` {
+		t.Fatalf("got status %d, Content-Encoding %q, ETag %q", w.Code, w.Header().Get("Content-Encoding"), etag)
+	}
+
+	tests := []struct {
+		acceptEncoding string
+		ifNoneMatch    string
+		wantStatus     int
+		wantETag       string
+	}{
+		{"gzip", etag, http.StatusNotModified, etag},
+		{"gzip", `W/"v1"`, http.StatusNotModified, `W/"v1"`},
+		{"", etag, http.StatusNotModified, `W/"v1"`},
+		{"gzip", `W/"v0-gzip"`, http.StatusOK, etag},
+	}
+
+	for _, test := range tests {
+		w := get(test.acceptEncoding, test.ifNoneMatch)
+		if w.Code != test.wantStatus || w.Header().Get("ETag") != test.wantETag {
+			t.Fatalf("Accept-Encoding %q, If-None-Match %q: got status %d, ETag %q, want %d, %q", test.acceptEncoding, test.ifNoneMatch, w.Code, w.Header().Get("ETag"), test.wantStatus, test.wantETag)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"chi-app/config"
+	"net/http"
+
+	"github.com/go-chi/cors"
+)
+
+// CORS answers preflight requests and adds the CORS headers for the
+// configured origins. Without origins it does nothing, the cors package
+// would otherwise allow every origin.
+func CORS(cfg config.CORS) func(http.Handler) http.Handler {
+	if len(cfg.AllowedOrigins) == 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	return cors.Handler(cors.Options{
+		AllowedOrigins:   cfg.AllowedOrigins,
+		AllowedMethods:   cfg.AllowedMethods,
+		AllowedHeaders:   cfg.AllowedHeaders,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           int(cfg.MaxAge.Seconds()),
+	})
+}
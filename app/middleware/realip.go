@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"chi-app/config"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIP replaces RemoteAddr with the client address the trusted proxies
+// forwarded, so rate limits, login throttling and logs see the client
+// rather than the load balancer. Requests from anywhere else keep their
+// RemoteAddr, a client could otherwise pick any address it likes.
+//
+// X-Forwarded-For is read from the right, every proxy appends the address
+// it received the request from, and the first address that is not a
+// trusted proxy is the client. X-Real-IP is used when there is no
+// X-Forwarded-For.
+func RealIP(cfg config.Server) func(http.Handler) http.Handler {
+	proxies := cfg.TrustedProxyPrefixes()
+
+	return func(next http.Handler) http.Handler {
+		if len(proxies) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if client, ok := forwardedClient(r, proxies); ok {
+				r.RemoteAddr = client.String()
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func forwardedClient(r *http.Request, proxies []netip.Prefix) (netip.Addr, bool) {
+	peer, ok := remoteAddr(r.RemoteAddr)
+	if !ok || !trusted(peer, proxies) {
+		return netip.Addr{}, false
+	}
+
+	forwarded := []string{}
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	if len(forwarded) == 0 {
+		client, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+		return client.Unmap(), err == nil
+	}
+
+	client := peer
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// whatever comes before a garbled entry was not written by
+			// a proxy we trust
+			break
+		}
+
+		client = addr.Unmap()
+		if !trusted(client, proxies) {
+			break
+		}
+	}
+
+	return client, client != peer
+}
+
+func remoteAddr(remoteAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	return addr.Unmap(), err == nil
+}
+
+func trusted(addr netip.Addr, proxies []netip.Prefix) bool {
+	for _, proxy := range proxies {
+		if proxy.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
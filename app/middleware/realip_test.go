@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"chi-app/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRealIP(t *testing.T) {
+	var remoteAddr string
+	handler := RealIP(config.Server{TrustedProxies: []string{"10.0.0.0/8", "192.168.1.5"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		value      string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4242", "", "", "203.0.113.7:4242"},
+		{"spoofed by a client", "203.0.113.7:4242", "X-Forwarded-For", "1.2.3.4", "203.0.113.7:4242"},
+		{"through the proxy", "10.0.0.2:4242", "X-Forwarded-For", "203.0.113.7", "203.0.113.7"},
+		{"proxy chain", "10.0.0.2:4242", "X-Forwarded-For", "203.0.113.7, 192.168.1.5", "203.0.113.7"},
+		{"spoofed behind the proxy", "10.0.0.2:4242", "X-Forwarded-For", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"garbled entry", "10.0.0.2:4242", "X-Forwarded-For", "203.0.113.7, nonsense, 192.168.1.5", "192.168.1.5"},
+		{"real ip header", "192.168.1.5:4242", "X-Real-IP", "2001:db8::1", "2001:db8::1"},
+		{"invalid real ip", "192.168.1.5:4242", "X-Real-IP", "unknown", "192.168.1.5:4242"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		if remoteAddr != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, remoteAddr, test.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"chi-app/app/helper"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+)
+
+// Recoverer turns a panicking handler into a 500 and logs the panic with
+// its stack, one broken request must not take the process down.
+// http.ErrAbortHandler is passed on, it is how a handler aborts a
+// response on purpose.
+func Recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			slog.ErrorContext(r.Context(), "panic",
+				slog.Any("panic", recovered),
+				slog.String("stack", string(debug.Stack())))
+
+			helper.Error(w, r, "Internal server error", http.StatusInternalServerError, nil, nil)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"chi-app/app/helper"
+	"chi-app/app/logging"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverer(t *testing.T) {
+	handler := logging.Middleware(Recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var campaigns map[int]string
+		campaigns[1] = "nil map"
+	})))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want 500", w.Code)
+	}
+
+	response := helper.ResponseFormatter{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Meta.RequestID == "" || response.Meta.RequestID != w.Header().Get(logging.RequestIDHeader) {
+		t.Fatalf("got request id %q, header %q", response.Meta.RequestID, w.Header().Get(logging.RequestIDHeader))
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"chi-app/config"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// apiPolicy fits JSON responses, nothing in them is ever rendered
+	apiPolicy = "default-src 'none'"
+
+	// mediaPolicy lets an uploaded file be shown as an image or played,
+	// the sandbox keeps scripts in an uploaded SVG from running
+	mediaPolicy = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'; sandbox"
+)
+
+// SecurityHeaders sets the headers every response gets. HSTS is sent on
+// plain HTTP as well, browsers ignore it there and a TLS terminating proxy
+// in front of the server passes it on.
+func SecurityHeaders(cfg config.Security) func(http.Handler) http.Handler {
+	hsts := ""
+	if cfg.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(cfg.HSTSMaxAge.Seconds()))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	frameAncestors := "'none'"
+	if cfg.FrameOptions == "SAMEORIGIN" {
+		frameAncestors = "'self'"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := w.Header()
+			header.Set("X-Content-Type-Options", "nosniff")
+			header.Set("X-Frame-Options", cfg.FrameOptions)
+			header.Set("Referrer-Policy", "no-referrer")
+			header.Set("Content-Security-Policy", apiPolicy+"; frame-ancestors "+frameAncestors)
+
+			if hsts != "" {
+				header.Set("Strict-Transport-Security", hsts)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MediaHeaders replaces the API policy on routes that serve uploaded
+// files, and lets pages on other origins embed them.
+func MediaHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", mediaPolicy)
+		w.Header().Set("Cross-Origin-Resource-Policy", "cross-origin")
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"chi-app/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := config.Default().CORS
+	cfg.AllowedOrigins = []string{"https://app.example.com"}
+	cfg.AllowCredentials = true
+
+	handler := CORS(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodOptions, "/api/v1/campaigns", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	r.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, r)
+
+	header := w.Header()
+	if header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		header.Get("Access-Control-Allow-Credentials") != "true" ||
+		header.Get("Access-Control-Max-Age") != "600" {
+		t.Fatalf("unexpected preflight answer: %v", header)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/v1/campaigns", nil)
+	r.Header.Set("Origin", "https://evil.example.org")
+	w = httptest.NewRecorder()
+
+	handler.ServeHTTP(w, r)
+
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Fatalf("allowed origin %q that is not configured", origin)
+	}
+
+	// no origins configured means no CORS at all
+	handler = CORS(config.Default().CORS)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if origin := w.Header().Get("Access-Control-Allow-Origin"); origin != "" {
+		t.Fatalf("allowed origin %q without configuration", origin)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	cfg := config.Security{HSTSMaxAge: 24 * time.Hour, HSTSIncludeSubdomains: true, FrameOptions: "DENY"}
+	handler := SecurityHeaders(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/campaigns", nil))
+
+	want := map[string]string{
+		"Strict-Transport-Security": "max-age=86400; includeSubDomains",
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           "DENY",
+		"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+	}
+
+	for name, value := range want {
+		if got := w.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	SecurityHeaders(cfg)(MediaHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/images/1-avatar.png", nil))
+
+	if got := w.Header().Get("Content-Security-Policy"); got != mediaPolicy {
+		t.Errorf("media policy = %q", got)
+	}
+}
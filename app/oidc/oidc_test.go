@@ -0,0 +1,173 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// mockProvider is a minimal OpenID Connect issuer that hands out one
+// authorization code bound to a PKCE challenge and a nonce.
+type mockProvider struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	clientID      string
+	codeChallenge string
+	nonce         string
+	audience      string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockProvider{key: key, clientID: "client-id", audience: "client-id"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.PublicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.PublicKey.E)).Bytes()),
+			}},
+		})
+	})
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		if r.PostForm.Get("code") != "valid-code" || CodeChallenge(r.PostForm.Get("code_verifier")) != m.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		claim := jwt.MapClaims{
+			"iss":            m.server.URL,
+			"aud":            m.audience,
+			"sub":            "subject-1",
+			"email":          "backer@example.com",
+			"email_verified": true,
+			"name":           "Backer",
+			"nonce":          m.nonce,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claim)
+		token.Header["kid"] = "test-key"
+
+		idToken, err := token.SignedString(m.key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	return m
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "mock",
+		DiscoveryURL: m.server.URL + "/.well-known/openid-configuration",
+		ClientID:     m.clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+	}, m.server.Client())
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockProvider(t)
+
+	authURL, err := m.provider().AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := parsed.Query()
+	if parsed.Path != "/authorize" || query.Get("state") != "state" || query.Get("code_challenge") != "challenge" || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization url %s", authURL)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	m.codeChallenge = CodeChallenge("verifier")
+	m.nonce = "nonce"
+
+	claims, err := m.provider().Exchange(context.Background(), "valid-code", "verifier", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "subject-1" || claims.Email != "backer@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	m.codeChallenge = CodeChallenge("verifier")
+	m.nonce = "nonce"
+
+	_, err := m.provider().Exchange(context.Background(), "valid-code", "other-verifier", "nonce")
+	if err == nil {
+		t.Fatal("expected an error for a wrong code verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	m := newMockProvider(t)
+	m.codeChallenge = CodeChallenge("verifier")
+	m.nonce = "nonce"
+
+	_, err := m.provider().Exchange(context.Background(), "valid-code", "verifier", "other-nonce")
+	if err == nil {
+		t.Fatal("expected an error for a wrong nonce")
+	}
+}
+
+func TestExchangeRejectsWrongAudience(t *testing.T) {
+	m := newMockProvider(t)
+	m.codeChallenge = CodeChallenge("verifier")
+	m.nonce = "nonce"
+	m.audience = "another-client"
+
+	_, err := m.provider().Exchange(context.Background(), "valid-code", "verifier", "nonce")
+	if err == nil {
+		t.Fatal("expected an error for a wrong audience")
+	}
+}
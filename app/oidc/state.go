@@ -0,0 +1,160 @@
+package oidc
+
+import (
+	"chi-app/database"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AuthRequest is what has to survive between redirecting the browser to
+// the provider and handling the callback.
+type AuthRequest struct {
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	ExpiresAt    time.Time
+}
+
+// StateStore keeps the AuthRequest of every login in progress under its
+// state. Take hands a request out at most once, ok is false when there is
+// none or it expired.
+type StateStore interface {
+	Save(ctx context.Context, state string, request AuthRequest) error
+	Take(ctx context.Context, state string) (AuthRequest, bool, error)
+}
+
+type stateStore struct {
+	DB *database.DB
+}
+
+// NewStateStore keeps the requests in the database, the callback may
+// reach another replica than the one that started the login.
+func NewStateStore(DB *database.DB) StateStore {
+	return &stateStore{DB}
+}
+
+func (s *stateStore) Save(ctx context.Context, state string, request AuthRequest) error {
+	ctx, span := startSpan(ctx, "oidc.StateStore.Save")
+	defer span.End()
+
+	// logins that were never finished are dropped on the way
+	sqlDelete := s.DB.Builder().Delete("oauth_states").
+		Where(sq.Lt{"expires_at": time.Now().UTC()}).
+		RunWith(s.DB.Runner(ctx))
+
+	_, err := sqlDelete.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqlInsert := s.DB.Builder().Insert("oauth_states").
+		Columns("state", "provider", "code_verifier", "nonce", "expires_at").
+		Values(state, request.Provider, request.CodeVerifier, request.Nonce, request.ExpiresAt.UTC()).
+		RunWith(s.DB.Runner(ctx))
+
+	_, err = sqlInsert.ExecContext(ctx)
+	return err
+}
+
+func (s *stateStore) Take(ctx context.Context, state string) (AuthRequest, bool, error) {
+	ctx, span := startSpan(ctx, "oidc.StateStore.Take")
+	defer span.End()
+
+	request := AuthRequest{}
+
+	err := s.DB.Builder().Select("provider", "code_verifier", "nonce", "expires_at").
+		From("oauth_states").
+		Where(sq.Eq{"state": state}).
+		RunWith(s.DB.Runner(ctx)).
+		QueryRowContext(ctx).
+		Scan(&request.Provider, &request.CodeVerifier, &request.Nonce, &request.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return request, false, nil
+	}
+
+	if err != nil {
+		return request, false, err
+	}
+
+	sqlDelete := s.DB.Builder().Delete("oauth_states").
+		Where(sq.Eq{"state": state}).
+		RunWith(s.DB.Runner(ctx))
+
+	result, err := sqlDelete.ExecContext(ctx)
+	if err != nil {
+		return request, false, err
+	}
+
+	// of two callbacks with the same state only the one that deleted it
+	// gets the request
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return request, false, err
+	}
+
+	return request, deleted > 0 && time.Now().Before(request.ExpiresAt), nil
+}
+
+// startSpan is tracing.Start, which cannot be imported here: tracing needs
+// config and config needs this package.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return otel.Tracer("chi-app").Start(ctx, name)
+}
+
+type memoryStateStore struct {
+	mu       sync.Mutex
+	requests map[string]AuthRequest
+}
+
+func NewMemoryStateStore() StateStore {
+	return &memoryStateStore{requests: map[string]AuthRequest{}}
+}
+
+func (s *memoryStateStore) Save(ctx context.Context, state string, request AuthRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, pending := range s.requests {
+		if now.After(pending.ExpiresAt) {
+			delete(s.requests, key)
+		}
+	}
+
+	s.requests[state] = request
+	return nil
+}
+
+func (s *memoryStateStore) Take(ctx context.Context, state string) (AuthRequest, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, ok := s.requests[state]
+	if !ok {
+		return request, false, nil
+	}
+
+	delete(s.requests, state)
+
+	return request, time.Now().Before(request.ExpiresAt), nil
+}
+
+func RandomString(size int) (string, error) {
+	random := make([]byte, size)
+
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
@@ -0,0 +1,49 @@
+package oidc
+
+import (
+	"chi-app/database/databasetest"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStateStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) StateStore{
+		"memory": func(t *testing.T) StateStore { return NewMemoryStateStore() },
+		"sql":    func(t *testing.T) StateStore { return NewStateStore(databasetest.NewSQLite(t)) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+
+			request := AuthRequest{Provider: "github", CodeVerifier: "verifier", Nonce: "nonce", ExpiresAt: time.Now().Add(time.Minute)}
+			if err := store.Save(ctx, "current", request); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+
+			expired := AuthRequest{Provider: "github", CodeVerifier: "verifier", Nonce: "nonce", ExpiresAt: time.Now().Add(-time.Minute)}
+			if err := store.Save(ctx, "expired", expired); err != nil {
+				t.Fatalf("save expired: %v", err)
+			}
+
+			taken, ok, err := store.Take(ctx, "current")
+			if err != nil || !ok || taken.Provider != request.Provider || taken.CodeVerifier != request.CodeVerifier || taken.Nonce != request.Nonce {
+				t.Fatalf("take: got %+v, %v, %v", taken, ok, err)
+			}
+
+			if _, ok, err := store.Take(ctx, "current"); err != nil || ok {
+				t.Fatalf("take twice: got %v, %v, want the state to be gone", ok, err)
+			}
+
+			if _, ok, err := store.Take(ctx, "expired"); err != nil || ok {
+				t.Fatalf("take expired: got %v, %v, want no request", ok, err)
+			}
+
+			if _, ok, err := store.Take(ctx, "unknown"); err != nil || ok {
+				t.Fatalf("take unknown: got %v, %v, want no request", ok, err)
+			}
+		})
+	}
+}
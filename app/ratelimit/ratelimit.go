@@ -0,0 +1,164 @@
+// Package ratelimit limits requests with token buckets. Each route group
+// has its own budget, and requests are counted per API key, per user or
+// per client IP, whichever identifies the caller most precisely. Buckets
+// live in a Store: MemoryStore for a single instance, RedisStore when
+// several replicas have to share the budget.
+package ratelimit
+
+import (
+	"chi-app/app/apikey"
+	"chi-app/app/helper"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period. The bucket holds Requests tokens and
+// refills evenly over the period, so a burst of Requests is allowed once
+// the bucket is full. The zero Limit does not limit anything.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit reads a limit written as "<requests>/<period>", e.g. "10/1m"
+// or "300/1m". "off" disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q must look like 10/1m", s)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 1 {
+		return Limit{}, fmt.Errorf("rate limit %q must allow at least one request", s)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q needs a positive period", s)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Requests == 0
+}
+
+// rate is the refill speed in tokens per second.
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+// Result is the state of a bucket after a request took from it.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// result describes a bucket that has tokens left after the request.
+func (l Limit) result(allowed bool, tokens float64) Result {
+	result := Result{
+		Allowed:   allowed,
+		Limit:     l.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(l.Requests) - tokens) / l.rate()),
+	}
+
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / l.rate())
+	}
+
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Store takes a token from the bucket named key.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+type Limiter struct {
+	store Store
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store}
+}
+
+// Middleware limits the route group named group. It has to run after the
+// auth middleware for the requests to be counted per user or API key,
+// before it they are counted per IP. A failing store lets the request
+// through, an outage of Redis must not take the API down with it.
+func (l *Limiter) Middleware(group string, limit Limit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit.Unlimited() {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result, err := l.store.Take(r.Context(), group+":"+identity(r), limit)
+			if err != nil {
+				slog.WarnContext(r.Context(), "rate limit store failed", slog.String("group", group), slog.Any("error", err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(math.Ceil(limit.Period.Seconds()))))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				helper.Error(w, r, "Too many requests", http.StatusTooManyRequests, "rate limit exceeded, please try again later", nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// identity names the caller, the API key when one was used, the user of
+// a session, the client IP otherwise.
+func identity(r *http.Request) string {
+	if apiKey, ok := r.Context().Value(key.CtxKeyAPIKey{}).(apikey.APIKey); ok {
+		return "key:" + strconv.Itoa(apiKey.ID)
+	}
+
+	if user, ok := r.Context().Value(key.CtxKeyAuth{}).(user.User); ok {
+		return "user:" + strconv.Itoa(user.ID)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
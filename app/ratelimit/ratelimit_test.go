@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"chi-app/app/helper"
+	"chi-app/app/key"
+	"chi-app/app/user"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Limit
+		valid bool
+	}{
+		{"10/1m", Limit{Requests: 10, Period: time.Minute}, true},
+		{" 300/1s ", Limit{Requests: 300, Period: time.Second}, true},
+		{"off", Limit{}, true},
+		{"10", Limit{}, false},
+		{"0/1m", Limit{}, false},
+		{"10/0s", Limit{}, false},
+		{"ten/1m", Limit{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := ParseLimit(test.value)
+		if (err == nil) != test.valid || got != test.want {
+			t.Errorf("ParseLimit(%q) = %+v, %v", test.value, got, err)
+		}
+	}
+}
+
+// testBucket runs the same scenario against any store, now is moved by
+// the test instead of sleeping.
+func testBucket(t *testing.T, store Store, now *time.Time) {
+	t.Helper()
+
+	ctx := context.Background()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Take(ctx, "auth:ip:10.0.0.1", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, result)
+		}
+	}
+
+	result, err := store.Take(ctx, "auth:ip:10.0.0.1", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Allowed || result.RetryAfter != time.Second || result.Reset != 3*time.Second {
+		t.Fatalf("empty bucket: %+v", result)
+	}
+
+	result, _ = store.Take(ctx, "auth:ip:10.0.0.2", limit)
+	if !result.Allowed {
+		t.Fatal("another client shares the bucket")
+	}
+
+	*now = now.Add(time.Second)
+
+	result, _ = store.Take(ctx, "auth:ip:10.0.0.1", limit)
+	if !result.Allowed || result.Remaining != 0 {
+		t.Fatalf("after one second: %+v", result)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	testBucket(t, store, &now)
+
+	now = now.Add(time.Minute)
+	store.sweep()
+
+	if len(store.buckets) != 0 {
+		t.Fatalf("%d refilled buckets were not swept", len(store.buckets))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore())
+	handler := limiter.Middleware("auth", Limit{Requests: 1, Period: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/sessions", nil)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "1" || w.Header().Get("RateLimit-Remaining") != "0" || w.Header().Get("RateLimit-Policy") != "1;w=60" {
+		t.Fatalf("first request: %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Fatalf("second request: %d %v", w.Code, w.Header())
+	}
+
+	response := helper.ResponseFormatter{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Meta.Code != http.StatusTooManyRequests || response.Meta.Status != "error" {
+		t.Fatalf("unexpected envelope: %s", w.Body.String())
+	}
+
+	// the same address signed in is counted on its own
+	ctx := context.WithValue(r.Context(), key.CtxKeyAuth{}, user.User{ID: 7})
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r.WithContext(ctx))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("user request: %d", w.Code)
+	}
+}
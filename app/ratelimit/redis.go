@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and takes from the bucket in one step, so replicas
+// sharing a bucket cannot both spend its last token. The bucket is a hash
+// of the tokens left and the time of the last refill in milliseconds, and
+// expires once it would have refilled anyway.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil or updated == nil then
+	tokens = capacity
+	updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore keeps the buckets in Redis, or anything that speaks its
+// protocol and runs Lua scripts, so every replica spends from the same
+// budget. Replica clocks are assumed to be roughly in sync.
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+	now    func() time.Time
+}
+
+// NewRedisStore prefixes every bucket key with prefix, e.g. "ratelimit:".
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: prefix,
+		now:    time.Now,
+	}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now().UnixMilli()
+	ratePerMilli := limit.rate() / 1000
+
+	reply, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests,
+		strconv.FormatFloat(ratePerMilli, 'g', -1, 64),
+		now,
+	).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := reply[0].(int64)
+	tokensLeft, _ := reply[1].(string)
+
+	tokens, err := strconv.ParseFloat(tokensLeft, 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return limit.result(allowed == 1, tokens), nil
+}
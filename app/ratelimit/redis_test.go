@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newRedisClient uses the Redis at REDIS_URL, e.g. redis://localhost:6379/15,
+// and an in-process miniredis when it is not set.
+func newRedisClient(t *testing.T) *redis.Client {
+	t.Helper()
+
+	url := os.Getenv("REDIS_URL")
+	if url == "" {
+		url = "redis://" + miniredis.RunT(t).Addr()
+	}
+
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := redis.NewClient(options)
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	return client
+}
+
+func TestRedisStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// a fresh prefix per run keeps a shared Redis from carrying buckets
+	// over between runs
+	store := NewRedisStore(newRedisClient(t), "ratelimit-test:"+time.Now().Format(time.RFC3339Nano)+":")
+	store.now = func() time.Time { return now }
+
+	testBucket(t, store, &now)
+
+	client := store.client.(*redis.Client)
+	ttl, err := client.PTTL(context.Background(), store.prefix+"auth:ip:10.0.0.1").Result()
+	if err != nil || ttl <= 0 || ttl > 5*time.Second {
+		t.Fatalf("bucket ttl %s, %v", ttl, err)
+	}
+}
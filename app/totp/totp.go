@@ -0,0 +1,109 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// https://datatracker.ietf.org/doc/html/rfc6238
+// reference TOTP with the defaults every authenticator app understands:
+// SHA1, 6 digits and a 30 second period
+const (
+	period     = 30
+	digits     = 6
+	secretSize = 20
+	skewSteps  = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(secret), nil
+}
+
+func URI(issuer string, accountName string, secret string) string {
+	label := url.PathEscape(fmt.Sprintf("%s:%s", issuer, accountName))
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(digits))
+	query.Set("period", fmt.Sprint(period))
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+func Code(secret string, t time.Time) (string, error) {
+	return hotp(secret, uint64(t.Unix()/period))
+}
+
+// Validate accepts codes from one step before and after t to allow for
+// clock drift between the server and the authenticator app.
+func Validate(secret string, code string, t time.Time) bool {
+	_, ok := ValidateStep(secret, code, t)
+	return ok
+}
+
+// ValidateStep is Validate returning the time step the code belongs to,
+// callers keep the last accepted step to refuse a code seen before.
+func ValidateStep(secret string, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != digits {
+		return 0, false
+	}
+
+	counter := t.Unix() / period
+	for step := -skewSteps; step <= skewSteps; step++ {
+		expected, err := hotp(secret, uint64(counter+int64(step)))
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter + int64(step), true
+		}
+	}
+
+	return 0, false
+}
+
+func QRCodePNG(uri string, size int) ([]byte, error) {
+	return qrcode.Encode(uri, qrcode.Medium, size)
+}
+
+func hotp(secret string, counter uint64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", digits, value%1000000), nil
+}
@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the ASCII key "12345678901234567890" of the RFC test
+// vectors, base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	// https://datatracker.ietf.org/doc/html/rfc4226#appendix-D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range want {
+		got, err := hotp(rfcSecret, uint64(counter))
+		if err != nil {
+			t.Fatalf("hotp(%d): %v", counter, err)
+		}
+
+		if got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	// https://datatracker.ietf.org/doc/html/rfc6238#appendix-B, SHA1, the
+	// last six of the eight digits listed there
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		got, err := Code(rfcSecret, time.Unix(test.unix, 0))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", test.unix, err)
+		}
+
+		if got != test.want {
+			t.Errorf("Code(%d) = %s, want %s", test.unix, got, test.want)
+		}
+	}
+}
+
+func TestValidateStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	counter := now.Unix() / period
+
+	tests := []struct {
+		offset time.Duration
+		ok     bool
+	}{
+		{0, true},
+		{-period * time.Second, true},
+		{period * time.Second, true},
+		{-2 * period * time.Second, false},
+		{2 * period * time.Second, false},
+	}
+
+	for _, test := range tests {
+		code, err := Code(rfcSecret, now.Add(test.offset))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+
+		step, ok := ValidateStep(rfcSecret, code, now)
+		if ok != test.ok {
+			t.Errorf("code from %v away: got ok %v, want %v", test.offset, ok, test.ok)
+		}
+
+		if ok && step != counter+int64(test.offset/(period*time.Second)) {
+			t.Errorf("code from %v away: got step %d, want %d", test.offset, step, counter+int64(test.offset/(period*time.Second)))
+		}
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if Validate(rfcSecret, code, now) {
+			t.Errorf("Validate(%q) = true, want false", code)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"chi-app/config"
+	"chi-app/database/databasetest"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+	})
+
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := newRecorder(t)
+	db := databasetest.NewSQLite(t)
+
+	router := chi.NewRouter()
+	router.Use(Middleware)
+	router.Get("/campaigns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := Start(r.Context(), "handler.GetCampaignDetail")
+		defer span.End()
+
+		var count int
+		db.Runner(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM campaigns WHERE id = ?", chi.URLParam(r, "id")).Scan(&count)
+
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/campaigns/7", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	server, ok := spans["GET /campaigns/{id}"]
+	if !ok {
+		t.Fatalf("no span named after the route, got %v", spans)
+	}
+
+	if server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id %s does not continue the traceparent header", server.SpanContext().TraceID())
+	}
+
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" || !server.Parent().IsRemote() {
+		t.Errorf("server span parent is %v, want the remote caller", server.Parent())
+	}
+
+	if server.Status().Code.String() != "Error" {
+		t.Errorf("server span status %v, want Error for a 500", server.Status())
+	}
+
+	handler := spans["handler.GetCampaignDetail"]
+	if handler == nil || handler.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatal("handler span is not a child of the server span")
+	}
+
+	statement := spans["db SELECT"]
+	if statement == nil || statement.Parent().SpanID() != handler.SpanContext().SpanID() {
+		t.Fatal("statement span is not a child of the handler span")
+	}
+
+	for _, attribute := range statement.Attributes() {
+		if attribute.Key == "db.statement" && attribute.Value.AsString() != "SELECT COUNT(*) FROM campaigns WHERE id = ?" {
+			t.Errorf("db.statement = %q", attribute.Value.AsString())
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := Setup(context.Background(), config.Tracing{Exporters: []string{"stdout"}, ServiceName: "chi-campaign", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	err = shutdown(context.Background())
+	if err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+}
@@ -2,14 +2,46 @@ package user
 
 import "time"
 
+// PasswordHash and TOTPSecret must never be serialised, even when a User
+// ends up inside another struct that is marshalled as a whole.
 type User struct {
 	ID             int    `json:"id"`
 	Name           string `json:"name"`
 	Occupation     string `json:"occupation"`
 	Email          string `json:"email"`
-	PasswordHash   string `json:"password_hash"`
+	PasswordHash   string `json:"-"`
 	AvatarFileName string `json:"avatar_file_name"`
+	Bio            string `json:"bio"`
 	Role           string `json:"role"`
+	TOTPSecret     string `json:"-"`
+	TOTPEnabled    bool   `json:"-"`
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
+
+type LoginAttempt struct {
+	Key          string
+	FailedCount  int
+	LastFailedAt time.Time
+	LockedUntil  time.Time
+}
+
+type RecoveryCode struct {
+	ID       int
+	UserID   int
+	CodeHash string
+}
+
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+type Identity struct {
+	ID        int
+	UserID    int
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
@@ -1,5 +1,7 @@
 package user
 
+import "encoding/base64"
+
 type UserFormatter struct {
 	ID         int    `json:"id"`
 	Name       string `json:"name"`
@@ -18,3 +20,33 @@ func FormatUser(user User, token string) UserFormatter {
 
 	return formatter
 }
+
+type TwoFactorChallengeFormatter struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+func FormatTwoFactorChallenge(challengeToken string, expiresIn int) TwoFactorChallengeFormatter {
+	formatter := TwoFactorChallengeFormatter{}
+	formatter.TwoFactorRequired = true
+	formatter.ChallengeToken = challengeToken
+	formatter.ExpiresIn = expiresIn
+
+	return formatter
+}
+
+type TwoFactorEnrollmentFormatter struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+	QRCode     string `json:"qr_code"`
+}
+
+func FormatTwoFactorEnrollment(enrollment TwoFactorEnrollment, qrCodePNG []byte) TwoFactorEnrollmentFormatter {
+	formatter := TwoFactorEnrollmentFormatter{}
+	formatter.Secret = enrollment.Secret
+	formatter.OtpauthURI = enrollment.URI
+	formatter.QRCode = "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCodePNG)
+
+	return formatter
+}
@@ -1,10 +1,15 @@
 package user
 
+import (
+	"mime/multipart"
+	"time"
+)
+
 type RegisterUserInput struct {
 	Name       string `json:"name" validate:"required"`
 	Occupation string `json:"occupation" validate:"required"`
 	Email      string `json:"email" validate:"required,email"`
-	Password   string `json:"password" validate:"required"`
+	Password   string `json:"password" validate:"required,max=72"`
 }
 
 type CheckEmailAvailableInput struct {
@@ -12,6 +17,41 @@ type CheckEmailAvailableInput struct {
 }
 
 type LoginUserInput struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required"`
+	IPAddress string `json:"-"`
+}
+
+type UnlockUserInput struct {
+	ID int `uri:"id" validate:"required"`
+}
+
+type ConfirmTwoFactorInput struct {
+	Code string `json:"code" validate:"required"`
+	User User   `json:"-"`
+}
+
+type UploadAvatarInput struct {
+	Alias  string                `form:"alias" validate:"omitempty,safe_filename"`
+	Avatar *multipart.FileHeader `form:"avatar" validate:"required"`
+}
+
+type VerifyTwoFactorInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+	UserID         int    `json:"-"`
+	IPAddress      string `json:"-"`
+
+	// ChallengeID and ChallengeExpiresAt come from the challenge token,
+	// it is spent by a successful verification
+	ChallengeID        string    `json:"-"`
+	ChallengeExpiresAt time.Time `json:"-"`
+}
+
+type SocialLoginInput struct {
+	Provider      string `validate:"required"`
+	Subject       string `validate:"required"`
+	Email         string `validate:"required,email"`
+	EmailVerified bool
+	Name          string
 }
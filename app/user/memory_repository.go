@@ -0,0 +1,278 @@
+package user
+
+import (
+	"chi-app/app/apperror"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryRepository keeps users in process memory. It follows the SQL
+// repository, including its unique constraints and the columns Update
+// writes, so services can be tested without a database.
+type memoryRepository struct {
+	mu             sync.RWMutex
+	users          map[int]User
+	lastUserID     int
+	loginAttempts  map[string]LoginAttempt
+	recoveryCodes  map[int]memoryRecoveryCode
+	lastCodeID     int
+	identities     map[int]Identity
+	lastIdentityID int
+	totpSteps      map[int]int64
+	usedChallenges map[string]time.Time
+}
+
+type memoryRecoveryCode struct {
+	RecoveryCode
+	Used bool
+}
+
+func NewMemoryUserRepository() Repository {
+	return &memoryRepository{
+		users:          map[int]User{},
+		loginAttempts:  map[string]LoginAttempt{},
+		recoveryCodes:  map[int]memoryRecoveryCode{},
+		identities:     map[int]Identity{},
+		totpSteps:      map[int]int64{},
+		usedChallenges: map[string]time.Time{},
+	}
+}
+
+func (r *memoryRepository) Save(ctx context.Context, user User) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return user, apperror.Conflict("email has already been registered")
+		}
+	}
+
+	now := time.Now().UTC()
+
+	r.lastUserID++
+	user.ID = r.lastUserID
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	r.users[user.ID] = user
+	return user, nil
+}
+
+func (r *memoryRepository) FindByID(ctx context.Context, ID int) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[ID]
+	if !ok {
+		return User{}, apperror.NotFound("user not found")
+	}
+
+	return user, nil
+}
+
+func (r *memoryRepository) FindByEmail(ctx context.Context, email string) (User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+
+	return User{}, apperror.NotFound("user not found")
+}
+
+func (r *memoryRepository) Update(ctx context.Context, userID int, user User) (User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[userID]
+	if !ok {
+		return User{}, apperror.NotFound("user not found")
+	}
+
+	existing.AvatarFileName = user.AvatarFileName
+	existing.PasswordHash = user.PasswordHash
+	existing.TOTPSecret = user.TOTPSecret
+	existing.TOTPEnabled = user.TOTPEnabled
+	existing.UpdatedAt = time.Now().UTC()
+
+	r.users[userID] = existing
+	return existing, nil
+}
+
+func (r *memoryRepository) FindLoginAttempt(ctx context.Context, key string) (LoginAttempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.loginAttempts[key], nil
+}
+
+func (r *memoryRepository) IncrementLoginAttempt(ctx context.Context, key string, now time.Time, resetBefore time.Time) (LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.loginAttempts[key]
+	if !ok {
+		attempt = LoginAttempt{Key: key, LockedUntil: time.Time{}.UTC()}
+	}
+
+	if attempt.LastFailedAt.Before(resetBefore) {
+		attempt.FailedCount = 0
+	}
+
+	attempt.FailedCount++
+	attempt.LastFailedAt = now.UTC()
+
+	r.loginAttempts[key] = attempt
+	return attempt, nil
+}
+
+func (r *memoryRepository) LockLoginAttempt(ctx context.Context, key string, lockedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.loginAttempts[key]
+	if ok && attempt.LockedUntil.Before(lockedUntil) {
+		attempt.LockedUntil = lockedUntil.UTC()
+		r.loginAttempts[key] = attempt
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) DeleteLoginAttempt(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.loginAttempts, key)
+	return nil
+}
+
+func (r *memoryRepository) FindUnusedRecoveryCodes(ctx context.Context, userID int) ([]RecoveryCode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	recoveryCodes := []RecoveryCode{}
+	for _, recoveryCode := range r.recoveryCodes {
+		if recoveryCode.UserID == userID && !recoveryCode.Used {
+			recoveryCodes = append(recoveryCodes, recoveryCode.RecoveryCode)
+		}
+	}
+
+	sort.Slice(recoveryCodes, func(i, j int) bool {
+		return recoveryCodes[i].ID < recoveryCodes[j].ID
+	})
+
+	return recoveryCodes, nil
+}
+
+func (r *memoryRepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ID, recoveryCode := range r.recoveryCodes {
+		if recoveryCode.UserID == userID {
+			delete(r.recoveryCodes, ID)
+		}
+	}
+
+	for _, codeHash := range codeHashes {
+		r.lastCodeID++
+
+		recoveryCode := memoryRecoveryCode{}
+		recoveryCode.ID = r.lastCodeID
+		recoveryCode.UserID = userID
+		recoveryCode.CodeHash = codeHash
+
+		r.recoveryCodes[recoveryCode.ID] = recoveryCode
+	}
+
+	return nil
+}
+
+func (r *memoryRepository) MarkRecoveryCodeUsed(ctx context.Context, ID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recoveryCode, ok := r.recoveryCodes[ID]
+	if !ok || recoveryCode.Used {
+		return apperror.Conflict("recovery code has already been used")
+	}
+
+	recoveryCode.Used = true
+	r.recoveryCodes[ID] = recoveryCode
+
+	return nil
+}
+
+func (r *memoryRepository) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[userID]; !ok || r.totpSteps[userID] >= step {
+		return apperror.Conflict("two-factor code has already been used")
+	}
+
+	r.totpSteps[userID] = step
+	return nil
+}
+
+func (r *memoryRepository) UseChallengeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for usedID, usedExpiresAt := range r.usedChallenges {
+		if usedExpiresAt.Before(now) {
+			delete(r.usedChallenges, usedID)
+		}
+	}
+
+	if _, ok := r.usedChallenges[tokenID]; ok {
+		return apperror.Conflict("challenge token has already been used")
+	}
+
+	r.usedChallenges[tokenID] = expiresAt
+	return nil
+}
+
+func (r *memoryRepository) FindIdentity(ctx context.Context, provider string, subject string) (Identity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+
+	return Identity{}, apperror.NotFound("identity not found")
+}
+
+func (r *memoryRepository) SaveIdentity(ctx context.Context, identity Identity) (Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[identity.UserID]; !ok {
+		return identity, errors.New("user does not exist")
+	}
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return identity, apperror.Conflict("identity has already been linked")
+		}
+	}
+
+	r.lastIdentityID++
+	identity.ID = r.lastIdentityID
+	identity.CreatedAt = time.Now().UTC()
+
+	r.identities[identity.ID] = identity
+	return identity, nil
+}
@@ -1,41 +1,82 @@
 package user
 
 import (
-	"database/sql"
+	"chi-app/app/apperror"
+	"chi-app/app/tracing"
+	"chi-app/database"
+	"context"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
 type Repository interface {
-	Save(user User) (User, error)
-	FindByID(ID int) (User, error)
-	FindByEmail(email string) (User, error)
-	Update(userID int, user User) (User, error)
+	Save(ctx context.Context, user User) (User, error)
+	FindByID(ctx context.Context, ID int) (User, error)
+	FindByEmail(ctx context.Context, email string) (User, error)
+	Update(ctx context.Context, userID int, user User) (User, error)
+	// FindLoginAttempt returns a zero LoginAttempt for keys without
+	// recorded failures rather than ErrNotFound.
+	FindLoginAttempt(ctx context.Context, key string) (LoginAttempt, error)
+	// IncrementLoginAttempt counts one more failure for key in a single
+	// statement, starting over at one when the last failure happened
+	// before resetBefore, and returns the attempt as stored.
+	IncrementLoginAttempt(ctx context.Context, key string, now time.Time, resetBefore time.Time) (LoginAttempt, error)
+	LockLoginAttempt(ctx context.Context, key string, lockedUntil time.Time) error
+	DeleteLoginAttempt(ctx context.Context, key string) error
+	FindUnusedRecoveryCodes(ctx context.Context, userID int) ([]RecoveryCode, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	MarkRecoveryCodeUsed(ctx context.Context, ID int) error
+	// UseTOTPStep records the time step of an accepted code, a code of the
+	// same or an earlier step is refused with ErrConflict from then on.
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+	// UseChallengeToken refuses a challenge token used before with
+	// ErrConflict. Tokens are remembered until they expire anyway.
+	UseChallengeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	FindIdentity(ctx context.Context, provider string, subject string) (Identity, error)
+	SaveIdentity(ctx context.Context, identity Identity) (Identity, error)
 }
+
 type repository struct {
-	DB *sql.DB
+	DB *database.DB
 }
 
-func NewUserRepository(DB *sql.DB) Repository {
+func NewUserRepository(DB *database.DB) Repository {
 	return &repository{DB}
 }
 
-// https://kodingin.com/golang-insert-data-mysql/
-// reference layoutDateTime for UTC
-const (
-	layoutDateTime string = "2006-01-02 15:04:05"
-)
+var userColumns = []string{
+	"id",
+	"name",
+	"occupation",
+	"email",
+	"password_hash",
+	"avatar_file_name",
+	"bio",
+	"role",
+	"totp_secret",
+	"totp_enabled",
+	"created_at",
+	"updated_at",
+}
 
-func (r *repository) Save(user User) (User, error) {
-	sqlQuery := sq.Insert("users").
+func (r *repository) Save(ctx context.Context, user User) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.Save")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	sqlQuery := r.DB.Builder().Insert("users").
 		Columns(
 			"name",
 			"occupation",
 			"email",
 			"password_hash",
 			"avatar_file_name",
+			"bio",
 			"role",
+			"totp_secret",
+			"totp_enabled",
 			"created_at",
 			"updated_at").
 		Values(
@@ -44,22 +85,23 @@ func (r *repository) Save(user User) (User, error) {
 			user.Email,
 			user.PasswordHash,
 			user.AvatarFileName,
+			user.Bio,
 			user.Role,
-			time.Now().Format(layoutDateTime),
-			time.Now().Format(layoutDateTime)).
-		RunWith(r.DB)
+			user.TOTPSecret,
+			user.TOTPEnabled,
+			now,
+			now)
 
-	result, err := sqlQuery.Exec()
-	if err != nil {
-		return user, err
+	userID, err := r.DB.InsertReturningID(ctx, sqlQuery)
+	if database.IsUniqueViolation(err) {
+		return user, apperror.Conflict("email has already been registered")
 	}
 
-	userID, err := result.LastInsertId()
 	if err != nil {
 		return user, err
 	}
 
-	newUser, err := r.FindByID(int(userID))
+	newUser, err := r.FindByID(ctx, int(userID))
 	if err != nil {
 		return newUser, err
 	}
@@ -67,106 +109,453 @@ func (r *repository) Save(user User) (User, error) {
 	return newUser, nil
 }
 
-func (r *repository) FindByID(ID int) (User, error) {
+func (r *repository) FindByID(ctx context.Context, ID int) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.FindByID")
+	defer span.End()
+
+	return r.findOne(ctx, sq.Eq{"id": ID})
+}
+
+func (r *repository) FindByEmail(ctx context.Context, email string) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.FindByEmail")
+	defer span.End()
+
+	return r.findOne(ctx, sq.Eq{"email": email})
+}
+
+func (r *repository) findOne(ctx context.Context, where sq.Eq) (User, error) {
 	user := User{}
 
-	sqlQuery := sq.Select(
-		"id",
-		"name",
-		"occupation",
-		"email",
-		"password_hash",
-		"avatar_file_name",
-		"role",
-		"created_at",
-		"updated_at").
+	sqlQuery := r.DB.Builder().Select(userColumns...).
 		From("users").
-		Where(sq.Eq{"id": ID})
+		Where(where)
 
-	rows, err := sqlQuery.RunWith(r.DB).Query()
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
 	if err != nil {
 		return user, err
 	}
 
 	defer rows.Close()
 
-	if rows.Next() {
-		rows.Scan(
-			&user.ID,
-			&user.Name,
-			&user.Occupation,
-			&user.Email,
-			&user.PasswordHash,
-			&user.AvatarFileName,
-			&user.Role,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-		)
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return user, err
+		}
+
+		return user, apperror.NotFound("user not found")
+	}
+
+	err = rows.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Occupation,
+		&user.Email,
+		&user.PasswordHash,
+		&user.AvatarFileName,
+		&user.Bio,
+		&user.Role,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return User{}, err
 	}
 
 	return user, nil
 }
 
-func (r *repository) FindByEmail(email string) (User, error) {
-	user := User{}
+func (r *repository) Update(ctx context.Context, userID int, user User) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.Update")
+	defer span.End()
 
-	sqlQuery := sq.Select(
-		"id",
-		"name",
-		"occupation",
-		"email",
-		"password_hash",
-		"avatar_file_name",
-		"role",
-		"created_at",
-		"updated_at").
-		From("users").
-		Where(sq.Eq{"email": email})
+	sqlQuery := r.DB.Builder().Update("users").
+		Set("avatar_file_name", user.AvatarFileName).
+		Set("password_hash", user.PasswordHash).
+		Set("totp_secret", user.TOTPSecret).
+		Set("totp_enabled", user.TOTPEnabled).
+		Set("updated_at", time.Now().UTC()).
+		Where(sq.Eq{"id": userID}).
+		RunWith(r.DB.Runner(ctx))
 
-	rows, err := sqlQuery.RunWith(r.DB).Query()
+	_, err := sqlQuery.ExecContext(ctx)
 	if err != nil {
 		return user, err
 	}
 
+	updatedUser, err := r.FindByID(ctx, userID)
+	if err != nil {
+		return updatedUser, err
+	}
+
+	return updatedUser, nil
+}
+
+func (r *repository) FindLoginAttempt(ctx context.Context, key string) (LoginAttempt, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.FindLoginAttempt")
+	defer span.End()
+
+	attempt := LoginAttempt{}
+
+	sqlQuery := r.DB.Builder().Select(
+		"attempt_key",
+		"failed_count",
+		"last_failed_at",
+		"locked_until").
+		From("login_attempts").
+		Where(sq.Eq{"attempt_key": key})
+
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
+	if err != nil {
+		return attempt, err
+	}
+
 	defer rows.Close()
 
 	if rows.Next() {
-		rows.Scan(
-			&user.ID,
-			&user.Name,
-			&user.Occupation,
-			&user.Email,
-			&user.PasswordHash,
-			&user.AvatarFileName,
-			&user.Role,
-			&user.CreatedAt,
-			&user.UpdatedAt,
+		err := rows.Scan(
+			&attempt.Key,
+			&attempt.FailedCount,
+			&attempt.LastFailedAt,
+			&attempt.LockedUntil,
 		)
+
+		if err != nil {
+			return attempt, err
+		}
 	}
 
-	return user, nil
+	return attempt, rows.Err()
 }
 
-func (r *repository) Update(userID int, user User) (User, error) {
-	sqlQuery := sq.Update("users").
-		Set("avatar_file_name", user.AvatarFileName).
-		Where(sq.Eq{"id": userID}).
-		RunWith(r.DB)
+// IncrementLoginAttempt updates the row for key and falls back to an
+// insert when there is none yet, which keeps the query portable instead
+// of relying on a dialect specific upsert. An insert losing the race to a
+// concurrent one is counted by updating again.
+func (r *repository) IncrementLoginAttempt(ctx context.Context, key string, now time.Time, resetBefore time.Time) (LoginAttempt, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.IncrementLoginAttempt")
+	defer span.End()
 
-	result, err := sqlQuery.Exec()
+	incremented, err := r.incrementLoginAttempt(ctx, key, now, resetBefore)
 	if err != nil {
-		return user, err
+		return LoginAttempt{}, err
 	}
 
-	updatedID, err := result.LastInsertId()
+	if !incremented {
+		sqlInsert := r.DB.Builder().Insert("login_attempts").
+			Columns(
+				"attempt_key",
+				"failed_count",
+				"last_failed_at",
+				"locked_until").
+			Values(
+				key,
+				1,
+				now.UTC(),
+				time.Time{}.UTC()).
+			RunWith(r.DB.Runner(ctx))
+
+		_, insertErr := sqlInsert.ExecContext(ctx)
+		if insertErr != nil && !database.IsUniqueViolation(insertErr) {
+			return LoginAttempt{}, insertErr
+		}
+
+		if insertErr != nil {
+			incremented, err = r.incrementLoginAttempt(ctx, key, now, resetBefore)
+			if err != nil {
+				return LoginAttempt{}, err
+			}
+
+			if !incremented {
+				return LoginAttempt{}, insertErr
+			}
+		}
+	}
+
+	return r.FindLoginAttempt(ctx, key)
+}
+
+func (r *repository) incrementLoginAttempt(ctx context.Context, key string, now time.Time, resetBefore time.Time) (bool, error) {
+	// failed_count is set before last_failed_at, MySQL evaluates the
+	// assignments in order and would otherwise compare the new value
+	sqlUpdate := r.DB.Builder().Update("login_attempts").
+		Set("failed_count", sq.Expr("CASE WHEN last_failed_at < ? THEN 1 ELSE failed_count + 1 END", resetBefore.UTC())).
+		Set("last_failed_at", now.UTC()).
+		Where(sq.Eq{"attempt_key": key}).
+		RunWith(r.DB.Runner(ctx))
+
+	result, err := sqlUpdate.ExecContext(ctx)
 	if err != nil {
-		return user, err
+		return false, err
 	}
 
-	updatedUser, err := r.FindByID(int(updatedID))
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return updatedUser, err
+		return false, err
 	}
 
-	return updatedUser, nil
+	return affected > 0, nil
+}
+
+// LockLoginAttempt only ever extends the lock, a slower concurrent
+// failure must not shorten the lock a faster one set.
+func (r *repository) LockLoginAttempt(ctx context.Context, key string, lockedUntil time.Time) error {
+	ctx, span := tracing.Start(ctx, "user.Repository.LockLoginAttempt")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Update("login_attempts").
+		Set("locked_until", lockedUntil.UTC()).
+		Where(sq.And{sq.Eq{"attempt_key": key}, sq.Lt{"locked_until": lockedUntil.UTC()}}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlQuery.ExecContext(ctx)
+	return err
+}
+
+func (r *repository) DeleteLoginAttempt(ctx context.Context, key string) error {
+	ctx, span := tracing.Start(ctx, "user.Repository.DeleteLoginAttempt")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Delete("login_attempts").
+		Where(sq.Eq{"attempt_key": key}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlQuery.ExecContext(ctx)
+	return err
+}
+
+func (r *repository) FindUnusedRecoveryCodes(ctx context.Context, userID int) ([]RecoveryCode, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.FindUnusedRecoveryCodes")
+	defer span.End()
+
+	recoveryCodes := []RecoveryCode{}
+
+	sqlQuery := r.DB.Builder().Select(
+		"id",
+		"user_id",
+		"code_hash").
+		From("user_recovery_codes").
+		Where(sq.Eq{"user_id": userID, "used_at": nil}).
+		OrderBy("id")
+
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
+	if err != nil {
+		return recoveryCodes, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		recoveryCode := RecoveryCode{}
+
+		err := rows.Scan(
+			&recoveryCode.ID,
+			&recoveryCode.UserID,
+			&recoveryCode.CodeHash,
+		)
+
+		if err != nil {
+			return recoveryCodes, err
+		}
+
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+	}
+
+	return recoveryCodes, rows.Err()
+}
+
+func (r *repository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	ctx, span := tracing.Start(ctx, "user.Repository.ReplaceRecoveryCodes")
+	defer span.End()
+
+	sqlDelete := r.DB.Builder().Delete("user_recovery_codes").
+		Where(sq.Eq{"user_id": userID}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlDelete.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	sqlInsert := r.DB.Builder().Insert("user_recovery_codes").
+		Columns(
+			"user_id",
+			"code_hash",
+			"created_at")
+
+	for _, codeHash := range codeHashes {
+		sqlInsert = sqlInsert.Values(userID, codeHash, time.Now().UTC())
+	}
+
+	_, err = sqlInsert.RunWith(r.DB.Runner(ctx)).ExecContext(ctx)
+	return err
+}
+
+func (r *repository) MarkRecoveryCodeUsed(ctx context.Context, ID int) error {
+	ctx, span := tracing.Start(ctx, "user.Repository.MarkRecoveryCodeUsed")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Update("user_recovery_codes").
+		Set("used_at", time.Now().UTC()).
+		Where(sq.Eq{"id": ID, "used_at": nil}).
+		RunWith(r.DB.Runner(ctx))
+
+	result, err := sqlQuery.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return apperror.Conflict("recovery code has already been used")
+	}
+
+	return nil
+}
+
+func (r *repository) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	ctx, span := tracing.Start(ctx, "user.Repository.UseTOTPStep")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Update("users").
+		Set("totp_last_step", step).
+		Where(sq.And{sq.Eq{"id": userID}, sq.Lt{"totp_last_step": step}}).
+		RunWith(r.DB.Runner(ctx))
+
+	result, err := sqlQuery.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return apperror.Conflict("two-factor code has already been used")
+	}
+
+	return nil
+}
+
+func (r *repository) UseChallengeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "user.Repository.UseChallengeToken")
+	defer span.End()
+
+	sqlDelete := r.DB.Builder().Delete("used_challenge_tokens").
+		Where(sq.Lt{"expires_at": time.Now().UTC()}).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlDelete.ExecContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqlInsert := r.DB.Builder().Insert("used_challenge_tokens").
+		Columns("token_id", "expires_at").
+		Values(tokenID, expiresAt.UTC()).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err = sqlInsert.ExecContext(ctx)
+	if database.IsUniqueViolation(err) {
+		return apperror.Conflict("challenge token has already been used")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) FindIdentity(ctx context.Context, provider string, subject string) (Identity, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.FindIdentity")
+	defer span.End()
+
+	identity := Identity{}
+
+	sqlQuery := r.DB.Builder().Select(
+		"id",
+		"user_id",
+		"provider",
+		"subject",
+		"email",
+		"created_at").
+		From("user_identities").
+		Where(sq.Eq{"provider": provider, "subject": subject})
+
+	rows, err := sqlQuery.RunWith(r.DB.Runner(ctx)).QueryContext(ctx)
+	if err != nil {
+		return identity, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return identity, err
+		}
+
+		return identity, apperror.NotFound("identity not found")
+	}
+
+	err = rows.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	return identity, nil
+}
+
+func (r *repository) SaveIdentity(ctx context.Context, identity Identity) (Identity, error) {
+	ctx, span := tracing.Start(ctx, "user.Repository.SaveIdentity")
+	defer span.End()
+
+	sqlQuery := r.DB.Builder().Insert("user_identities").
+		Columns(
+			"user_id",
+			"provider",
+			"subject",
+			"email",
+			"created_at").
+		Values(
+			identity.UserID,
+			identity.Provider,
+			identity.Subject,
+			identity.Email,
+			time.Now().UTC()).
+		RunWith(r.DB.Runner(ctx))
+
+	_, err := sqlQuery.ExecContext(ctx)
+	if database.IsUniqueViolation(err) {
+		return identity, apperror.Conflict("identity has already been linked")
+	}
+
+	if err != nil {
+		return identity, err
+	}
+
+	newIdentity, err := r.FindIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		return newIdentity, err
+	}
+
+	return newIdentity, nil
 }
@@ -0,0 +1,390 @@
+package user
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewMemoryUserRepository()
+	})
+}
+
+func TestSQLRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewUserRepository(databasetest.NewSQLite(t))
+	})
+}
+
+// testRepository is the contract every Repository implementation has to
+// satisfy.
+func testRepository(t *testing.T, newRepository func(t *testing.T) Repository) {
+	ctx := context.Background()
+
+	newUser := func(email string) User {
+		return User{
+			Name:         "Budi",
+			Occupation:   "Developer",
+			Email:        email,
+			PasswordHash: "hash",
+			Role:         "user",
+		}
+	}
+
+	t.Run("save and find", func(t *testing.T) {
+		repo := newRepository(t)
+
+		first, err := repo.Save(ctx, newUser("budi@example.com"))
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+
+		second, err := repo.Save(ctx, newUser("sari@example.com"))
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+
+		if first.ID == 0 || second.ID <= first.ID {
+			t.Fatalf("ids not increasing: %d, %d", first.ID, second.ID)
+		}
+
+		if first.CreatedAt.IsZero() || first.UpdatedAt.IsZero() {
+			t.Fatalf("timestamps not set: %+v", first)
+		}
+
+		found, err := repo.FindByID(ctx, first.ID)
+		if err != nil {
+			t.Fatalf("find by id: %v", err)
+		}
+
+		if found.Email != "budi@example.com" || found.Name != "Budi" || found.PasswordHash != "hash" || found.Role != "user" {
+			t.Fatalf("unexpected user: %+v", found)
+		}
+
+		found, err = repo.FindByEmail(ctx, "sari@example.com")
+		if err != nil {
+			t.Fatalf("find by email: %v", err)
+		}
+
+		if found.ID != second.ID {
+			t.Fatalf("found user %d, want %d", found.ID, second.ID)
+		}
+	})
+
+	t.Run("concurrent saves", func(t *testing.T) {
+		repo := newRepository(t)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+
+				_, err := repo.Save(ctx, newUser(fmt.Sprintf("user%d@example.com", i)))
+				errs <- err
+			}(i)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("save: %v", err)
+			}
+		}
+
+		seen := map[int]bool{}
+		for i := 0; i < 10; i++ {
+			user, err := repo.FindByEmail(ctx, fmt.Sprintf("user%d@example.com", i))
+			if err != nil {
+				t.Fatalf("find by email: %v", err)
+			}
+
+			if user.ID == 0 || seen[user.ID] {
+				t.Fatalf("user %d has id %d", i, user.ID)
+			}
+
+			seen[user.ID] = true
+		}
+	})
+
+	t.Run("missing user", func(t *testing.T) {
+		repo := newRepository(t)
+
+		_, err := repo.FindByID(ctx, 42)
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("find by id: got %v, want ErrNotFound", err)
+		}
+
+		_, err = repo.FindByEmail(ctx, "nobody@example.com")
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("find by email: got %v, want ErrNotFound", err)
+		}
+
+		_, err = repo.Update(ctx, 42, User{})
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("update: got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("email is unique", func(t *testing.T) {
+		repo := newRepository(t)
+
+		_, err := repo.Save(ctx, newUser("budi@example.com"))
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+
+		_, err = repo.Save(ctx, newUser("budi@example.com"))
+		if !errors.Is(err, apperror.ErrConflict) {
+			t.Fatalf("save the same email again: got %v, want ErrConflict", err)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo := newRepository(t)
+
+		user, err := repo.Save(ctx, newUser("budi@example.com"))
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+
+		user.Name = "Ignored"
+		user.AvatarFileName = "1-avatar.png"
+		user.PasswordHash = "new-hash"
+		user.TOTPSecret = "SECRET"
+		user.TOTPEnabled = true
+
+		updated, err := repo.Update(ctx, user.ID, user)
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+
+		if updated.AvatarFileName != "1-avatar.png" || updated.PasswordHash != "new-hash" || updated.TOTPSecret != "SECRET" || !updated.TOTPEnabled {
+			t.Fatalf("update not applied: %+v", updated)
+		}
+
+		if updated.Name != "Budi" {
+			t.Fatalf("update changed name to %q", updated.Name)
+		}
+	})
+
+	t.Run("login attempts", func(t *testing.T) {
+		repo := newRepository(t)
+
+		key := "account:budi@example.com"
+		now := time.Now().UTC().Truncate(time.Second)
+		lockedUntil := now.Add(time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := repo.IncrementLoginAttempt(ctx, key, now, now.Add(-time.Hour))
+				if err != nil {
+					t.Errorf("increment: %v", err)
+				}
+			}()
+		}
+
+		wg.Wait()
+
+		err := repo.LockLoginAttempt(ctx, key, lockedUntil)
+		if err != nil {
+			t.Fatalf("lock: %v", err)
+		}
+
+		// an earlier lock does not shorten the one in place
+		err = repo.LockLoginAttempt(ctx, key, now)
+		if err != nil {
+			t.Fatalf("lock again: %v", err)
+		}
+
+		found, err := repo.FindLoginAttempt(ctx, key)
+		if err != nil {
+			t.Fatalf("find: %v", err)
+		}
+
+		if found.Key != key || found.FailedCount != 10 || !found.LastFailedAt.Equal(now) || !found.LockedUntil.Equal(lockedUntil) {
+			t.Fatalf("unexpected attempt: %+v", found)
+		}
+
+		// the last failure is older than the window, counting starts over
+		later := now.Add(2 * time.Hour)
+		found, err = repo.IncrementLoginAttempt(ctx, key, later, later.Add(-time.Hour))
+		if err != nil {
+			t.Fatalf("increment after window: %v", err)
+		}
+
+		if found.FailedCount != 1 || !found.LastFailedAt.Equal(later) {
+			t.Fatalf("count not reset after window: %+v", found)
+		}
+
+		err = repo.DeleteLoginAttempt(ctx, key)
+		if err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+
+		found, err = repo.FindLoginAttempt(ctx, key)
+		if err != nil {
+			t.Fatalf("find after delete: %v", err)
+		}
+
+		if found.Key != "" {
+			t.Fatalf("attempt still present: %+v", found)
+		}
+	})
+
+	t.Run("recovery codes", func(t *testing.T) {
+		repo := newRepository(t)
+
+		user, err := repo.Save(ctx, newUser("budi@example.com"))
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+
+		err = repo.ReplaceRecoveryCodes(ctx, user.ID, []string{"a", "b", "c"})
+		if err != nil {
+			t.Fatalf("replace: %v", err)
+		}
+
+		codes, err := repo.FindUnusedRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("find: %v", err)
+		}
+
+		if len(codes) != 3 || codes[0].CodeHash != "a" || codes[2].CodeHash != "c" {
+			t.Fatalf("unexpected codes: %+v", codes)
+		}
+
+		err = repo.MarkRecoveryCodeUsed(ctx, codes[1].ID)
+		if err != nil {
+			t.Fatalf("mark used: %v", err)
+		}
+
+		err = repo.MarkRecoveryCodeUsed(ctx, codes[1].ID)
+		if !errors.Is(err, apperror.ErrConflict) {
+			t.Fatalf("mark used twice: got %v, want ErrConflict", err)
+		}
+
+		codes, err = repo.FindUnusedRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("find: %v", err)
+		}
+
+		if len(codes) != 2 || codes[0].CodeHash != "a" || codes[1].CodeHash != "c" {
+			t.Fatalf("unexpected codes after use: %+v", codes)
+		}
+
+		err = repo.ReplaceRecoveryCodes(ctx, user.ID, []string{"d"})
+		if err != nil {
+			t.Fatalf("replace again: %v", err)
+		}
+
+		codes, err = repo.FindUnusedRecoveryCodes(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("find: %v", err)
+		}
+
+		if len(codes) != 1 || codes[0].CodeHash != "d" {
+			t.Fatalf("old codes survived replace: %+v", codes)
+		}
+	})
+
+	t.Run("totp steps", func(t *testing.T) {
+		repo := newRepository(t)
+
+		user, err := repo.Save(ctx, newUser("budi@example.com"))
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+
+		err = repo.UseTOTPStep(ctx, user.ID, 100)
+		if err != nil {
+			t.Fatalf("use step: %v", err)
+		}
+
+		for _, step := range []int64{100, 99} {
+			err = repo.UseTOTPStep(ctx, user.ID, step)
+			if !errors.Is(err, apperror.ErrConflict) {
+				t.Fatalf("use step %d again: got %v, want ErrConflict", step, err)
+			}
+		}
+
+		err = repo.UseTOTPStep(ctx, user.ID, 101)
+		if err != nil {
+			t.Fatalf("use next step: %v", err)
+		}
+	})
+
+	t.Run("challenge tokens", func(t *testing.T) {
+		repo := newRepository(t)
+
+		expiresAt := time.Now().Add(time.Minute)
+
+		err := repo.UseChallengeToken(ctx, "first", expiresAt)
+		if err != nil {
+			t.Fatalf("use token: %v", err)
+		}
+
+		err = repo.UseChallengeToken(ctx, "first", expiresAt)
+		if !errors.Is(err, apperror.ErrConflict) {
+			t.Fatalf("use token again: got %v, want ErrConflict", err)
+		}
+
+		err = repo.UseChallengeToken(ctx, "second", expiresAt)
+		if err != nil {
+			t.Fatalf("use another token: %v", err)
+		}
+	})
+
+	t.Run("identities", func(t *testing.T) {
+		repo := newRepository(t)
+
+		user, err := repo.Save(ctx, newUser("budi@example.com"))
+		if err != nil {
+			t.Fatalf("save: %v", err)
+		}
+
+		identity := Identity{UserID: user.ID, Provider: "google", Subject: "1234", Email: "budi@example.com"}
+
+		saved, err := repo.SaveIdentity(ctx, identity)
+		if err != nil {
+			t.Fatalf("save identity: %v", err)
+		}
+
+		if saved.ID == 0 || saved.CreatedAt.IsZero() {
+			t.Fatalf("identity not stored: %+v", saved)
+		}
+
+		found, err := repo.FindIdentity(ctx, "google", "1234")
+		if err != nil {
+			t.Fatalf("find identity: %v", err)
+		}
+
+		if found.ID != saved.ID || found.UserID != user.ID {
+			t.Fatalf("unexpected identity: %+v", found)
+		}
+
+		_, err = repo.SaveIdentity(ctx, identity)
+		if !errors.Is(err, apperror.ErrConflict) {
+			t.Fatalf("link the same identity again: got %v, want ErrConflict", err)
+		}
+
+		_, err = repo.FindIdentity(ctx, "github", "1234")
+		if !errors.Is(err, apperror.ErrNotFound) {
+			t.Fatalf("find identity for another provider: got %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -1,34 +1,111 @@
 package user
 
 import (
+	"chi-app/app/apperror"
+	"chi-app/app/totp"
+	"chi-app/app/tracing"
+	"chi-app/database"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Service interface {
-	RegisterUser(input RegisterUserInput) (User, error)
-	IsEmailAvailable(input CheckEmailAvailableInput) (bool, error)
-	LoginUser(input LoginUserInput) (User, error)
-	GetUserByID(userID int) (User, error)
-	UploadAvatar(userID int, fileLocation string) (User, error)
+	RegisterUser(ctx context.Context, input RegisterUserInput) (User, error)
+	IsEmailAvailable(ctx context.Context, input CheckEmailAvailableInput) (bool, error)
+	LoginUser(ctx context.Context, input LoginUserInput) (User, error)
+	GetUserByID(ctx context.Context, userID int) (User, error)
+	UploadAvatar(ctx context.Context, userID int, fileLocation string) (User, error)
+	UnlockUser(ctx context.Context, input UnlockUserInput) (User, error)
+	EnrollTwoFactor(ctx context.Context, userID int) (TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, input ConfirmTwoFactorInput) ([]string, error)
+	VerifyTwoFactor(ctx context.Context, input VerifyTwoFactorInput) (User, error)
+	LoginWithIdentity(ctx context.Context, input SocialLoginInput) (User, error)
+}
+
+// SecurityPolicy controls password hashing and login throttling. Failed
+// logins are counted per account and per client IP; once the free
+// attempts are used up every further failure locks the key for
+// LockoutBase, doubling each time up to LockoutMax. A key without a
+// failure for AttemptWindow starts over with all its free attempts.
+type SecurityPolicy struct {
+	BcryptCost          int
+	AccountFreeAttempts int
+	IPFreeAttempts      int
+	LockoutBase         time.Duration
+	LockoutMax          time.Duration
+	AttemptWindow       time.Duration
+	TOTPIssuer          string
+	RecoveryCodeCount   int
+}
+
+func DefaultSecurityPolicy() SecurityPolicy {
+	return SecurityPolicy{
+		BcryptCost:          bcrypt.DefaultCost,
+		AccountFreeAttempts: 5,
+		IPFreeAttempts:      20,
+		LockoutBase:         30 * time.Second,
+		LockoutMax:          15 * time.Minute,
+		AttemptWindow:       24 * time.Hour,
+		TOTPIssuer:          "chi-campaign",
+		RecoveryCodeCount:   10,
+	}
+}
+
+type LoginLockedError struct {
+	LockedUntil time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+func (e *LoginLockedError) RetryAfter() time.Duration {
+	return time.Until(e.LockedUntil)
 }
 
 type userService struct {
 	userRepository Repository
+	transactor     database.Transactor
+	policy         SecurityPolicy
+
+	dummyHashOnce sync.Once
+	dummyHash     []byte
 }
 
-func NewUserService(userRepository Repository) Service {
-	return &userService{userRepository}
+func NewUserService(userRepository Repository, transactor database.Transactor, policy SecurityPolicy) Service {
+	return &userService{userRepository: userRepository, transactor: transactor, policy: policy}
 }
 
-func (s *userService) RegisterUser(input RegisterUserInput) (User, error) {
+func (s *userService) RegisterUser(ctx context.Context, input RegisterUserInput) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.RegisterUser")
+	defer span.End()
+
 	user := User{}
 	user.Name = input.Name
 	user.Occupation = input.Occupation
 	user.Email = input.Email
 
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.MinCost)
+	_, err := s.userRepository.FindByEmail(ctx, user.Email)
+	if err == nil {
+		return user, apperror.Conflict("email has already been registered")
+	}
+
+	if !errors.Is(err, apperror.ErrNotFound) {
+		return user, err
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(input.Password), s.policy.BcryptCost)
 	if err != nil {
 		return user, err
 	}
@@ -36,7 +113,7 @@ func (s *userService) RegisterUser(input RegisterUserInput) (User, error) {
 	user.PasswordHash = string(passwordHash)
 	user.Role = "user"
 
-	newUser, err := s.userRepository.Save(user)
+	newUser, err := s.userRepository.Save(ctx, user)
 	if err != nil {
 		return newUser, err
 	}
@@ -44,42 +121,172 @@ func (s *userService) RegisterUser(input RegisterUserInput) (User, error) {
 	return newUser, nil
 }
 
-func (s *userService) IsEmailAvailable(input CheckEmailAvailableInput) (bool, error) {
-	user, err := s.userRepository.FindByEmail(input.Email)
-	if err != nil {
-		return false, err
-	}
+func (s *userService) IsEmailAvailable(ctx context.Context, input CheckEmailAvailableInput) (bool, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.IsEmailAvailable")
+	defer span.End()
 
-	if user.ID == 0 {
+	_, err := s.userRepository.FindByEmail(ctx, input.Email)
+	if errors.Is(err, apperror.ErrNotFound) {
 		return true, nil
 	}
 
+	if err != nil {
+		return false, err
+	}
+
 	return false, nil
 }
 
-func (s *userService) LoginUser(input LoginUserInput) (User, error) {
+func (s *userService) LoginUser(ctx context.Context, input LoginUserInput) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.LoginUser")
+	defer span.End()
+
 	email := input.Email
 	password := input.Password
 
-	user, err := s.userRepository.FindByEmail(email)
+	accountKey := accountAttemptKey(email)
+	ipKey := ipAttemptKey(input.IPAddress)
+
+	err := s.checkLocked(ctx, accountKey, ipKey)
 	if err != nil {
-		return user, err
+		return User{}, err
+	}
+
+	user, err := s.userRepository.FindByEmail(ctx, email)
+	if errors.Is(err, apperror.ErrNotFound) {
+		// as slow as a wrong password, the response time must not tell
+		// which emails are registered
+		bcrypt.CompareHashAndPassword(s.getDummyHash(), []byte(password))
+
+		return user, s.loginFailed(ctx, accountKey, ipKey)
 	}
 
-	if user.ID == 0 {
-		return user, errors.New("email or password not match")
+	if err != nil {
+		return user, err
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
-		return user, errors.New("email or password not match")
+		return user, s.loginFailed(ctx, accountKey, ipKey)
+	}
+
+	err = s.userRepository.DeleteLoginAttempt(ctx, accountKey)
+	if err != nil {
+		return user, err
+	}
+
+	// hashes created with an older, cheaper cost are upgraded while the
+	// plain password is at hand
+	cost, err := bcrypt.Cost([]byte(user.PasswordHash))
+	if err == nil && cost < s.policy.BcryptCost {
+		passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), s.policy.BcryptCost)
+		if err != nil {
+			return user, err
+		}
+
+		user.PasswordHash = string(passwordHash)
+
+		user, err = s.userRepository.Update(ctx, user.ID, user)
+		if err != nil {
+			return user, err
+		}
 	}
 
 	return user, nil
 }
 
-func (s *userService) GetUserByID(userID int) (User, error) {
-	user, err := s.userRepository.FindByID(userID)
+func (s *userService) checkLocked(ctx context.Context, keys ...string) error {
+	now := time.Now()
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		attempt, err := s.userRepository.FindLoginAttempt(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if attempt.LockedUntil.After(now) {
+			return &LoginLockedError{LockedUntil: attempt.LockedUntil}
+		}
+	}
+
+	return nil
+}
+
+func (s *userService) loginFailed(ctx context.Context, accountKey string, ipKey string) error {
+	err := s.recordFailure(ctx, accountKey, s.policy.AccountFreeAttempts)
+	if err != nil {
+		return err
+	}
+
+	if ipKey != "" {
+		err = s.recordFailure(ctx, ipKey, s.policy.IPFreeAttempts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return apperror.BadRequest("email or password not match")
+}
+
+func (s *userService) recordFailure(ctx context.Context, key string, freeAttempts int) error {
+	now := time.Now()
+
+	attempt, err := s.userRepository.IncrementLoginAttempt(ctx, key, now, now.Add(-s.policy.AttemptWindow))
+	if err != nil {
+		return err
+	}
+
+	if attempt.FailedCount <= freeAttempts {
+		return nil
+	}
+
+	return s.userRepository.LockLoginAttempt(ctx, key, now.Add(s.lockoutDuration(attempt.FailedCount-freeAttempts)))
+}
+
+// getDummyHash is hashed once with the configured cost, comparing with it
+// costs as much as comparing with a real password hash.
+func (s *userService) getDummyHash() []byte {
+	s.dummyHashOnce.Do(func() {
+		s.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), s.policy.BcryptCost)
+	})
+
+	return s.dummyHash
+}
+
+func (s *userService) lockoutDuration(excess int) time.Duration {
+	lockout := s.policy.LockoutBase
+	for i := 1; i < excess && lockout < s.policy.LockoutMax; i++ {
+		lockout *= 2
+	}
+
+	if lockout > s.policy.LockoutMax {
+		lockout = s.policy.LockoutMax
+	}
+
+	return lockout
+}
+
+func accountAttemptKey(email string) string {
+	return fmt.Sprintf("account:%s", strings.ToLower(strings.TrimSpace(email)))
+}
+
+func ipAttemptKey(ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("ip:%s", ip)
+}
+
+func (s *userService) GetUserByID(ctx context.Context, userID int) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.GetUserByID")
+	defer span.End()
+
+	user, err := s.userRepository.FindByID(ctx, userID)
 	if err != nil {
 		return user, err
 	}
@@ -87,18 +294,288 @@ func (s *userService) GetUserByID(userID int) (User, error) {
 	return user, nil
 }
 
-func (s *userService) UploadAvatar(userID int, fileLocation string) (User, error) {
-	user, err := s.userRepository.FindByID(userID)
+func (s *userService) UploadAvatar(ctx context.Context, userID int, fileLocation string) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.UploadAvatar")
+	defer span.End()
+
+	user, err := s.userRepository.FindByID(ctx, userID)
 	if err != nil {
 		return user, err
 	}
 
 	user.AvatarFileName = fileLocation
 
-	updatedUser, err := s.userRepository.Update(user.ID, user)
+	updatedUser, err := s.userRepository.Update(ctx, user.ID, user)
 	if err != nil {
 		return updatedUser, err
 	}
 
 	return updatedUser, nil
 }
+
+func (s *userService) UnlockUser(ctx context.Context, input UnlockUserInput) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.UnlockUser")
+	defer span.End()
+
+	user, err := s.userRepository.FindByID(ctx, input.ID)
+	if err != nil {
+		return user, err
+	}
+
+	err = s.userRepository.DeleteLoginAttempt(ctx, accountAttemptKey(user.Email))
+	if err != nil {
+		return user, err
+	}
+
+	return user, nil
+}
+
+func (s *userService) EnrollTwoFactor(ctx context.Context, userID int) (TwoFactorEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.EnrollTwoFactor")
+	defer span.End()
+
+	enrollment := TwoFactorEnrollment{}
+
+	user, err := s.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return enrollment, err
+	}
+
+	if user.TOTPEnabled {
+		return enrollment, apperror.Conflict("two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return enrollment, err
+	}
+
+	// the secret stays pending until ConfirmTwoFactor sees a valid code
+	user.TOTPSecret = secret
+
+	_, err = s.userRepository.Update(ctx, user.ID, user)
+	if err != nil {
+		return enrollment, err
+	}
+
+	enrollment.Secret = secret
+	enrollment.URI = totp.URI(s.policy.TOTPIssuer, user.Email, secret)
+
+	return enrollment, nil
+}
+
+func (s *userService) ConfirmTwoFactor(ctx context.Context, input ConfirmTwoFactorInput) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.ConfirmTwoFactor")
+	defer span.End()
+
+	user, err := s.userRepository.FindByID(ctx, input.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, apperror.Conflict("two-factor authentication is already enabled")
+	}
+
+	if user.TOTPSecret == "" {
+		return nil, apperror.Conflict("two-factor authentication has not been enrolled")
+	}
+
+	step, ok := totp.ValidateStep(user.TOTPSecret, input.Code, time.Now())
+	if !ok {
+		return nil, apperror.Validation("invalid two-factor code")
+	}
+
+	recoveryCodes := []string{}
+	codeHashes := []string{}
+	for i := 0; i < s.policy.RecoveryCodeCount; i++ {
+		recoveryCode, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		recoveryCodes = append(recoveryCodes, recoveryCode)
+		codeHashes = append(codeHashes, hashRecoveryCode(recoveryCode))
+	}
+
+	user.TOTPEnabled = true
+
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := s.userRepository.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+
+		err = s.userRepository.ReplaceRecoveryCodes(ctx, user.ID, codeHashes)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.userRepository.Update(ctx, user.ID, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recoveryCodes, nil
+}
+
+func (s *userService) VerifyTwoFactor(ctx context.Context, input VerifyTwoFactorInput) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.VerifyTwoFactor")
+	defer span.End()
+
+	attemptKey := fmt.Sprintf("2fa:%d", input.UserID)
+
+	err := s.checkLocked(ctx, attemptKey, ipAttemptKey(input.IPAddress))
+	if err != nil {
+		return User{}, err
+	}
+
+	user, err := s.userRepository.FindByID(ctx, input.UserID)
+	if err != nil {
+		return user, err
+	}
+
+	if !user.TOTPEnabled {
+		return user, apperror.Conflict("two-factor authentication is not enabled")
+	}
+
+	if step, ok := totp.ValidateStep(user.TOTPSecret, input.Code, time.Now()); ok {
+		return user, s.twoFactorVerified(ctx, input, attemptKey, func(ctx context.Context) error {
+			return s.userRepository.UseTOTPStep(ctx, user.ID, step)
+		})
+	}
+
+	recoveryCodes, err := s.userRepository.FindUnusedRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		return user, err
+	}
+
+	codeHash := hashRecoveryCode(input.Code)
+	for _, recoveryCode := range recoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(recoveryCode.CodeHash), []byte(codeHash)) == 1 {
+			return user, s.twoFactorVerified(ctx, input, attemptKey, func(ctx context.Context) error {
+				return s.userRepository.MarkRecoveryCodeUsed(ctx, recoveryCode.ID)
+			})
+		}
+	}
+
+	err = s.recordFailure(ctx, attemptKey, s.policy.AccountFreeAttempts)
+	if err != nil {
+		return user, err
+	}
+
+	return user, apperror.Validation("invalid two-factor code")
+}
+
+// twoFactorVerified spends the code and the challenge token together, a
+// second exchange of either fails and a refused one leaves the other
+// unspent.
+func (s *userService) twoFactorVerified(ctx context.Context, input VerifyTwoFactorInput, attemptKey string, spendCode func(ctx context.Context) error) error {
+	err := s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := spendCode(ctx)
+		if err != nil {
+			return err
+		}
+
+		return s.userRepository.UseChallengeToken(ctx, input.ChallengeID, input.ChallengeExpiresAt)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.userRepository.DeleteLoginAttempt(ctx, attemptKey)
+}
+
+func generateRecoveryCode() (string, error) {
+	random := make([]byte, 10)
+
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(random))
+	return fmt.Sprintf("%s-%s", code[:8], code[8:16]), nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// LoginWithIdentity resolves an external identity to a user. Known
+// identities log straight in; otherwise the identity is linked to the
+// account with the same email, or a new account is created, but only
+// when the provider has verified that email.
+func (s *userService) LoginWithIdentity(ctx context.Context, input SocialLoginInput) (User, error) {
+	ctx, span := tracing.Start(ctx, "user.Service.LoginWithIdentity")
+	defer span.End()
+
+	identity, err := s.userRepository.FindIdentity(ctx, input.Provider, input.Subject)
+	if err == nil {
+		return s.userRepository.FindByID(ctx, identity.UserID)
+	}
+
+	if !errors.Is(err, apperror.ErrNotFound) {
+		return User{}, err
+	}
+
+	if !input.EmailVerified {
+		return User{}, apperror.Forbidden("email address has not been verified by the provider")
+	}
+
+	user, err := s.userRepository.FindByEmail(ctx, input.Email)
+	if err != nil && !errors.Is(err, apperror.ErrNotFound) {
+		return user, err
+	}
+
+	// a new account without its identity row could never be signed into,
+	// so both are written in one transaction. A retried attempt starts
+	// again from the user read above, the one saved by the rolled back
+	// attempt does not exist.
+	var linkedUser User
+	err = s.transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		newUser := user
+		if newUser.ID == 0 {
+			newUser.Name = input.Name
+			newUser.Email = input.Email
+			newUser.Role = "user"
+
+			if newUser.Name == "" {
+				newUser.Name = strings.Split(input.Email, "@")[0]
+			}
+
+			// no password hash, so the account can only be used through
+			// linked identities until a password is set
+			savedUser, err := s.userRepository.Save(ctx, newUser)
+			if err != nil {
+				return err
+			}
+
+			newUser = savedUser
+		}
+
+		newIdentity := Identity{}
+		newIdentity.UserID = newUser.ID
+		newIdentity.Provider = input.Provider
+		newIdentity.Subject = input.Subject
+		newIdentity.Email = input.Email
+
+		_, err := s.userRepository.SaveIdentity(ctx, newIdentity)
+		if err != nil {
+			return err
+		}
+
+		linkedUser = newUser
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return linkedUser, nil
+}
@@ -0,0 +1,298 @@
+package user
+
+import (
+	"chi-app/app/apperror"
+	"chi-app/app/totp"
+	"chi-app/database"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestService(t *testing.T) (Service, Repository) {
+	db := databasetest.NewSQLite(t)
+	repo := NewUserRepository(db)
+
+	policy := DefaultSecurityPolicy()
+	policy.BcryptCost = bcrypt.MinCost
+
+	return NewUserService(repo, database.NewTxManager(db), policy), repo
+}
+
+func TestTwoFactorCannotBeReplayed(t *testing.T) {
+	ctx := context.Background()
+	service, _ := newTestService(t)
+
+	user, err := service.RegisterUser(ctx, RegisterUserInput{Name: "Budi", Occupation: "Developer", Email: "budi@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	enrollment, err := service.EnrollTwoFactor(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+
+	now := time.Now()
+	code, _ := totp.Code(enrollment.Secret, now)
+
+	recoveryCodes, err := service.ConfirmTwoFactor(ctx, ConfirmTwoFactorInput{User: user, Code: code})
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+
+	verify := func(challengeID string, code string) error {
+		_, err := service.VerifyTwoFactor(ctx, VerifyTwoFactorInput{
+			Code:               code,
+			UserID:             user.ID,
+			ChallengeID:        challengeID,
+			ChallengeExpiresAt: now.Add(time.Minute),
+		})
+
+		return err
+	}
+
+	// the code that confirmed the enrolment is spent already
+	if err := verify("first", code); !errors.Is(err, apperror.ErrConflict) {
+		t.Fatalf("verify with the confirmation code: got %v, want ErrConflict", err)
+	}
+
+	nextCode, _ := totp.Code(enrollment.Secret, now.Add(30*time.Second))
+	if err := verify("first", nextCode); err != nil {
+		t.Fatalf("verify with the next code: %v", err)
+	}
+
+	if err := verify("second", nextCode); !errors.Is(err, apperror.ErrConflict) {
+		t.Fatalf("verify with a used code: got %v, want ErrConflict", err)
+	}
+
+	// a recovery code is valid, the challenge is not any more
+	if err := verify("first", recoveryCodes[0]); !errors.Is(err, apperror.ErrConflict) {
+		t.Fatalf("verify with a used challenge: got %v, want ErrConflict", err)
+	}
+
+	// the refused exchange did not spend the recovery code
+	if err := verify("second", recoveryCodes[0]); err != nil {
+		t.Fatalf("verify with a recovery code: %v", err)
+	}
+}
+
+// deadlockOnce makes the first attempt of every transaction a deadlock
+// victim after its callback ran, the way a database aborts it at commit.
+type deadlockOnce struct {
+	database.Transactor
+	failed bool
+}
+
+func (d *deadlockOnce) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return d.Transactor.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := fn(ctx)
+		if err == nil && !d.failed {
+			d.failed = true
+			return &mysql.MySQLError{Number: 1213}
+		}
+
+		return err
+	})
+}
+
+func TestLoginWithIdentitySurvivesRetry(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.NewSQLite(t)
+	repo := NewUserRepository(db)
+
+	transactor := &deadlockOnce{Transactor: &database.TxManager{DB: db, MaxRetries: 1, RetryDelay: time.Millisecond}}
+	service := NewUserService(repo, transactor, DefaultSecurityPolicy())
+
+	user, err := service.LoginWithIdentity(ctx, SocialLoginInput{Provider: "google", Subject: "1234", Email: "budi@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	if !transactor.failed {
+		t.Fatal("transaction was not retried")
+	}
+
+	identity, err := repo.FindIdentity(ctx, "google", "1234")
+	if err != nil {
+		t.Fatalf("find identity: %v", err)
+	}
+
+	found, err := repo.FindByID(ctx, identity.UserID)
+	if err != nil {
+		t.Fatalf("find linked user: %v", err)
+	}
+
+	if found.ID != user.ID || found.Email != "budi@example.com" || found.Name != "budi" {
+		t.Fatalf("identity linked to %+v, login returned %+v", found, user)
+	}
+}
+
+func newMemoryService(policy SecurityPolicy) (*userService, Repository) {
+	repo := NewMemoryUserRepository()
+
+	return NewUserService(repo, nil, policy).(*userService), repo
+}
+
+func TestLoginUserLockout(t *testing.T) {
+	policy := DefaultSecurityPolicy()
+	policy.BcryptCost = bcrypt.MinCost
+	policy.AccountFreeAttempts = 3
+	policy.IPFreeAttempts = 100
+
+	cases := []struct {
+		name        string
+		earlier     int
+		earlierAge  time.Duration
+		failures    int
+		wantLocked  bool
+		wantLockout time.Duration
+	}{
+		{name: "free attempts", failures: 3},
+		{name: "locked after the free attempts", failures: 4, wantLocked: true, wantLockout: policy.LockoutBase},
+		{name: "lockout doubles", earlier: 4, earlierAge: time.Hour, failures: 1, wantLocked: true, wantLockout: 2 * policy.LockoutBase},
+		{name: "old failures are forgotten", earlier: 3, earlierAge: 2 * policy.AttemptWindow, failures: 1},
+		{name: "recent failures count", earlier: 3, earlierAge: policy.AttemptWindow / 2, failures: 1, wantLocked: true, wantLockout: policy.LockoutBase},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			service, repo := newMemoryService(policy)
+
+			_, err := service.RegisterUser(ctx, RegisterUserInput{Name: "Budi", Occupation: "Developer", Email: "budi@example.com", Password: "secret"})
+			if err != nil {
+				t.Fatalf("register: %v", err)
+			}
+
+			earlier := time.Now().Add(-tc.earlierAge)
+			for i := 0; i < tc.earlier; i++ {
+				_, err := repo.IncrementLoginAttempt(ctx, accountAttemptKey("budi@example.com"), earlier, earlier.Add(-policy.AttemptWindow))
+				if err != nil {
+					t.Fatalf("seed failure: %v", err)
+				}
+			}
+
+			for i := 0; i < tc.failures; i++ {
+				_, err := service.LoginUser(ctx, LoginUserInput{Email: "budi@example.com", Password: "wrong", IPAddress: "192.0.2.1"})
+				if err == nil {
+					t.Fatal("logged in with a wrong password")
+				}
+			}
+
+			before := time.Now()
+			_, err = service.LoginUser(ctx, LoginUserInput{Email: "budi@example.com", Password: "secret", IPAddress: "192.0.2.1"})
+
+			var locked *LoginLockedError
+			if !tc.wantLocked {
+				if err != nil {
+					t.Fatalf("login with the right password: %v", err)
+				}
+
+				return
+			}
+
+			if !errors.As(err, &locked) {
+				t.Fatalf("login of a locked account: got %v, want LoginLockedError", err)
+			}
+
+			// the lock was set a moment before the login that hit it
+			if lockout := locked.LockedUntil.Sub(before); lockout > tc.wantLockout || lockout < tc.wantLockout-time.Second {
+				t.Fatalf("lockout: got %v, want %v", lockout, tc.wantLockout)
+			}
+		})
+	}
+}
+
+func TestLoginUserUnknownEmail(t *testing.T) {
+	ctx := context.Background()
+
+	policy := DefaultSecurityPolicy()
+	policy.BcryptCost = bcrypt.MinCost + 1
+
+	service, repo := newMemoryService(policy)
+
+	_, err := service.RegisterUser(ctx, RegisterUserInput{Name: "Budi", Occupation: "Developer", Email: "budi@example.com", Password: "secret"})
+	if err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	_, wrongPassword := service.LoginUser(ctx, LoginUserInput{Email: "budi@example.com", Password: "wrong"})
+	_, unknownEmail := service.LoginUser(ctx, LoginUserInput{Email: "sari@example.com", Password: "wrong"})
+
+	// nothing tells the caller which of the emails is registered
+	if !errors.Is(unknownEmail, apperror.ErrBadRequest) || unknownEmail.Error() != wrongPassword.Error() {
+		t.Fatalf("unknown email: got %v, want the wrong password error %v", unknownEmail, wrongPassword)
+	}
+
+	// the password was compared with a hash as costly as a real one
+	cost, err := bcrypt.Cost(service.dummyHash)
+	if err != nil || cost != policy.BcryptCost {
+		t.Fatalf("dummy hash: got cost %d (%v), want %d", cost, err, policy.BcryptCost)
+	}
+
+	attempt, err := repo.FindLoginAttempt(ctx, accountAttemptKey("sari@example.com"))
+	if err != nil || attempt.FailedCount != 1 {
+		t.Fatalf("failure of the unknown email: got %+v (%v), want 1 failure", attempt, err)
+	}
+}
+
+func TestLoginUserRehash(t *testing.T) {
+	cases := []struct {
+		name     string
+		cost     int
+		wantCost int
+	}{
+		{name: "same cost", cost: bcrypt.MinCost, wantCost: bcrypt.MinCost},
+		{name: "higher cost", cost: bcrypt.MinCost + 1, wantCost: bcrypt.MinCost + 1},
+		{name: "lower cost", cost: bcrypt.MinCost - 1, wantCost: bcrypt.MinCost},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			policy := DefaultSecurityPolicy()
+			policy.BcryptCost = bcrypt.MinCost
+
+			service, repo := newMemoryService(policy)
+
+			registered, err := service.RegisterUser(ctx, RegisterUserInput{Name: "Budi", Occupation: "Developer", Email: "budi@example.com", Password: "secret"})
+			if err != nil {
+				t.Fatalf("register: %v", err)
+			}
+
+			// the cost was changed in the configuration since
+			policy.BcryptCost = tc.cost
+			service = NewUserService(repo, nil, policy).(*userService)
+
+			_, err = service.LoginUser(ctx, LoginUserInput{Email: "budi@example.com", Password: "secret"})
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+
+			stored, err := repo.FindByID(ctx, registered.ID)
+			if err != nil {
+				t.Fatalf("find user: %v", err)
+			}
+
+			cost, _ := bcrypt.Cost([]byte(stored.PasswordHash))
+			if cost != tc.wantCost {
+				t.Fatalf("stored hash: got cost %d, want %d", cost, tc.wantCost)
+			}
+
+			if tc.wantCost == bcrypt.MinCost && stored.PasswordHash != registered.PasswordHash {
+				t.Fatal("hash was replaced without a cost increase")
+			}
+
+			if bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte("secret")) != nil {
+				t.Fatal("stored hash does not match the password")
+			}
+		})
+	}
+}
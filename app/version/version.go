@@ -0,0 +1,52 @@
+// Package version describes the running build. Commit and BuildTime are
+// injected at build time:
+//
+//	go build -ldflags "-X chi-app/app/version.Version=v1.2.0 \
+//	    -X chi-app/app/version.Commit=$(git rev-parse HEAD) \
+//	    -X chi-app/app/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without ldflags the VCS details Go stamps into the binary are used.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	for _, setting := range buildInfo.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildTime == "":
+			info.BuildTime = setting.Value
+		}
+	}
+
+	return info
+}
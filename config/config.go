@@ -0,0 +1,534 @@
+// Package config loads the server settings. Every value can come from the
+// environment, a .env file or a YAML file. The environment wins over .env,
+// and .env wins over the YAML file. Anything that is still unset keeps the
+// default from Default.
+package config
+
+import (
+	"chi-app/app/oidc"
+	"chi-app/database"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultEnvFile    = ".env"
+	DefaultConfigFile = "config.yaml"
+)
+
+type Config struct {
+	Server      Server          `yaml:"server"`
+	Database    database.Config `yaml:"database"`
+	Auth        Auth            `yaml:"auth"`
+	OIDC        []oidc.Config   `yaml:"oidc"`
+	Tracing     Tracing         `yaml:"tracing"`
+	Log         Log             `yaml:"log"`
+	RateLimit   RateLimit       `yaml:"rate_limit"`
+	CORS        CORS            `yaml:"cors"`
+	Security    Security        `yaml:"security"`
+	Idempotency Idempotency     `yaml:"idempotency"`
+	Compression Compression     `yaml:"compression"`
+	Metrics     Metrics         `yaml:"metrics"`
+}
+
+type Server struct {
+	Port              int           `yaml:"port" env:"SERVER_PORT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownDelay     time.Duration `yaml:"shutdown_delay" env:"SERVER_SHUTDOWN_DELAY"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"SERVER_MAX_HEADER_BYTES"`
+	TLSCertFile       string        `yaml:"tls_cert_file" env:"SERVER_TLS_CERT_FILE"`
+	TLSKeyFile        string        `yaml:"tls_key_file" env:"SERVER_TLS_KEY_FILE"`
+
+	// TrustedProxies are the addresses or CIDRs of the reverse proxies in
+	// front of the server. Only their X-Forwarded-For and X-Real-IP
+	// headers are believed.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"SERVER_TRUSTED_PROXIES"`
+}
+
+// Addr is the listen address for http.Server.
+func (s Server) Addr() string {
+	return fmt.Sprintf(":%d", s.Port)
+}
+
+func (s Server) TLSEnabled() bool {
+	return s.TLSCertFile != "" && s.TLSKeyFile != ""
+}
+
+// TrustedProxyPrefixes parses TrustedProxies, a single address is a
+// prefix of its full length. Invalid entries are left out, Validate
+// reports them.
+func (s Server) TrustedProxyPrefixes() []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, proxy := range s.TrustedProxies {
+		prefix, err := parseProxy(proxy)
+		if err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes
+}
+
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if !strings.Contains(proxy, "/") {
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return prefix.Masked(), nil
+}
+
+type Auth struct {
+	SecretKey string `yaml:"secret_key" env:"SECRET_KEY"`
+
+	// BcryptCost zero keeps the cost of user.DefaultSecurityPolicy
+	BcryptCost int `yaml:"bcrypt_cost" env:"BCRYPT_COST"`
+
+	// LoginAttemptWindow zero keeps the window of
+	// user.DefaultSecurityPolicy, failed logins older than it are forgotten
+	LoginAttemptWindow time.Duration `yaml:"login_attempt_window" env:"LOGIN_ATTEMPT_WINDOW"`
+}
+
+// Tracing exporters are "otlp" and "stdout", no exporter keeps tracing
+// on but sends the spans nowhere.
+type Tracing struct {
+	Exporters    []string `yaml:"exporters" env:"TRACING_EXPORTERS"`
+	ServiceName  string   `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio  float64  `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+	OTLPEndpoint string   `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+}
+
+// Log levels are debug, info, warn and error, formats json and text.
+type Log struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// RateLimit budgets are written as "<requests>/<period>", e.g. "10/1m",
+// or "off". Auth covers login, registration and the email checker per IP,
+// Read the public campaign and profile reads per IP, Write everything
+// behind authentication per user or API key. Client counts the requests
+// to authenticated routes per IP before the credentials are checked, so
+// guessing API keys or tokens is throttled too. The budgets are parsed by
+// ratelimit.ParseLimit when the limiter is built.
+type RateLimit struct {
+	Store    string `yaml:"store" env:"RATE_LIMIT_STORE"`
+	RedisURL string `yaml:"redis_url" env:"RATE_LIMIT_REDIS_URL"`
+	Auth     string `yaml:"auth" env:"RATE_LIMIT_AUTH"`
+	Read     string `yaml:"read" env:"RATE_LIMIT_READ"`
+	Write    string `yaml:"write" env:"RATE_LIMIT_WRITE"`
+	Client   string `yaml:"client" env:"RATE_LIMIT_CLIENT"`
+}
+
+// CORS answers cross-origin requests from AllowedOrigins only, no origin
+// keeps cross-origin requests blocked. An origin may use one wildcard,
+// e.g. "https://*.example.com".
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowedMethods   []string      `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// Security sets Strict-Transport-Security for HSTSMaxAge, zero leaves the
+// header out.
+type Security struct {
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" env:"SECURITY_HSTS_MAX_AGE"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" env:"SECURITY_HSTS_INCLUDE_SUBDOMAINS"`
+	FrameOptions          string        `yaml:"frame_options" env:"SECURITY_FRAME_OPTIONS"`
+}
+
+// Idempotency keys are kept for TTL, a retry after that runs the request
+// again.
+type Idempotency struct {
+	TTL time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL"`
+}
+
+// Compression encodings are "br" and "gzip", in order of preference when
+// the client accepts both. No encoding turns compression off. Bodies
+// smaller than MinSize bytes are sent as they are.
+type Compression struct {
+	Encodings []string `yaml:"encodings" env:"COMPRESSION_ENCODINGS"`
+	MinSize   int      `yaml:"min_size" env:"COMPRESSION_MIN_SIZE"`
+}
+
+// Metrics are served on /metrics to scrapers sending Token as a bearer
+// token. Without a token the endpoint is not served at all.
+type Metrics struct {
+	Token string `yaml:"token" env:"METRICS_TOKEN"`
+}
+
+func Default() Config {
+	config := Config{}
+	config.Server.Port = 9000
+	config.Server.ReadTimeout = 15 * time.Second
+	config.Server.ReadHeaderTimeout = 5 * time.Second
+	config.Server.WriteTimeout = 30 * time.Second
+	config.Server.IdleTimeout = 2 * time.Minute
+	config.Server.ShutdownTimeout = 15 * time.Second
+	config.Server.MaxHeaderBytes = 1 << 20
+	config.Tracing.ServiceName = "chi-campaign"
+	config.Tracing.SampleRatio = 1
+	config.Log.Level = "info"
+	config.Log.Format = "json"
+	config.RateLimit.Store = "memory"
+	config.RateLimit.Auth = "10/1m"
+	config.RateLimit.Read = "300/1m"
+	config.RateLimit.Write = "60/1m"
+	config.RateLimit.Client = "600/1m"
+	config.CORS.AllowedMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	config.CORS.AllowedHeaders = []string{"Accept", "Accept-Language", "Authorization", "Content-Type", "X-API-Key", "X-Request-ID", "Idempotency-Key", "If-Match", "If-None-Match", "If-Modified-Since"}
+	config.CORS.ExposedHeaders = []string{"X-Request-ID", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", "Idempotent-Replayed", "ETag"}
+	config.CORS.MaxAge = 10 * time.Minute
+	config.Security.HSTSMaxAge = 365 * 24 * time.Hour
+	config.Security.FrameOptions = "DENY"
+	config.Idempotency.TTL = 24 * time.Hour
+	config.Compression.Encodings = []string{"br", "gzip"}
+	config.Compression.MinSize = 1024
+	config.Database.Driver = database.MySQL.Name
+	config.Database.MaxOpenConns = 100
+	config.Database.MaxIdleConns = 10
+	config.Database.ConnMaxIdleTime = 10 * time.Minute
+	config.Database.ConnMaxLifetime = 60 * time.Minute
+	config.Database.QueryTimeout = 5 * time.Second
+
+	return config
+}
+
+// Load reads .env and the YAML file named by CONFIG_FILE, config.yaml when
+// it is not set, on top of the defaults. Both files are optional unless
+// CONFIG_FILE names a file that does not exist.
+func Load() (Config, error) {
+	return load(DefaultEnvFile, os.LookupEnv)
+}
+
+func load(envFile string, lookupEnv func(string) (string, bool)) (Config, error) {
+	dotenv, err := godotenv.Read(envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("read %s: %w", envFile, err)
+	}
+
+	// real environment variables win over the ones from .env
+	lookup := func(key string) (string, bool) {
+		if value, ok := lookupEnv(key); ok {
+			return value, true
+		}
+
+		value, ok := dotenv[key]
+		return value, ok
+	}
+
+	config := Default()
+
+	configFile, _ := lookup("CONFIG_FILE")
+	explicit := configFile != ""
+	if !explicit {
+		configFile = DefaultConfigFile
+	}
+
+	content, err := os.ReadFile(configFile)
+	switch {
+	case err == nil:
+		err = yaml.Unmarshal(content, &config)
+		if err != nil {
+			return Config{}, fmt.Errorf("parse %s: %w", configFile, err)
+		}
+	case !errors.Is(err, os.ErrNotExist) || explicit:
+		return Config{}, fmt.Errorf("read %s: %w", configFile, err)
+	}
+
+	for _, section := range []interface{}{&config.Server, &config.Database, &config.Auth, &config.Tracing, &config.Log, &config.RateLimit, &config.CORS, &config.Security, &config.Idempotency, &config.Compression, &config.Metrics} {
+		err = overlay(reflect.ValueOf(section).Elem(), "", lookup)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	config.OIDC, err = oidcProviders(config.OIDC, lookup)
+	if err != nil {
+		return Config{}, err
+	}
+
+	return config, config.Validate()
+}
+
+// oidcProviders applies OIDC_PROVIDERS, a comma separated list of provider
+// names that replaces the YAML list, and the OIDC_<NAME>_* settings of
+// each provider.
+func oidcProviders(providers []oidc.Config, lookup func(string) (string, bool)) ([]oidc.Config, error) {
+	if names, _ := lookup("OIDC_PROVIDERS"); strings.TrimSpace(names) != "" {
+		fromFile := map[string]oidc.Config{}
+		for _, provider := range providers {
+			fromFile[strings.ToLower(provider.Name)] = provider
+		}
+
+		providers = []oidc.Config{}
+		for _, name := range splitList(names) {
+			name = strings.ToLower(name)
+
+			provider := fromFile[name]
+			provider.Name = name
+			providers = append(providers, provider)
+		}
+	}
+
+	for i := range providers {
+		prefix := "OIDC_" + strings.ToUpper(providers[i].Name) + "_"
+
+		err := overlay(reflect.ValueOf(&providers[i]).Elem(), prefix, lookup)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return providers, nil
+}
+
+// overlay sets every field with an env tag that lookup has a value for.
+// Empty values count as unset, so a copied .env.example does not blank
+// out the YAML file.
+func overlay(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("env")
+		if key == "" {
+			continue
+		}
+
+		key = prefix + key
+
+		value, _ := lookup(key)
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		err := setValue(v.Field(i), value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+
+		field.SetFloat(f)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		field.Set(reflect.ValueOf(splitList(value)))
+	default:
+		return fmt.Errorf("unsupported config type %s", field.Type())
+	}
+
+	return nil
+}
+
+// splitList accepts commas as well as spaces, OIDC scopes are usually
+// written space separated.
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// Validate reports every missing or invalid setting at once.
+func (c Config) Validate() error {
+	errs := []error{}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("SERVER_PORT must be between 1 and 65535, got %d", c.Server.Port))
+	}
+
+	if c.Database.QueryTimeout <= 0 {
+		errs = append(errs, errors.New("DB_QUERY_TIMEOUT must be positive"))
+	}
+
+	if c.Server.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("SERVER_SHUTDOWN_DELAY must not be negative"))
+	}
+
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SERVER_SHUTDOWN_TIMEOUT must be positive"))
+	}
+
+	if c.Server.MaxHeaderBytes < 0 {
+		errs = append(errs, errors.New("SERVER_MAX_HEADER_BYTES must not be negative"))
+	}
+
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together"))
+	}
+
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, err := parseProxy(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("SERVER_TRUSTED_PROXIES: %q is not an address or CIDR", proxy))
+		}
+	}
+
+	if c.Auth.SecretKey == "" {
+		errs = append(errs, errors.New("SECRET_KEY is required"))
+	}
+
+	if c.Auth.BcryptCost < 0 {
+		errs = append(errs, errors.New("BCRYPT_COST must not be negative"))
+	}
+
+	if c.Auth.LoginAttemptWindow < 0 {
+		errs = append(errs, errors.New("LOGIN_ATTEMPT_WINDOW must not be negative"))
+	}
+
+	errs = append(errs, c.validateDatabase()...)
+
+	for _, exporter := range c.Tracing.Exporters {
+		if exporter != "otlp" && exporter != "stdout" {
+			errs = append(errs, fmt.Errorf("TRACING_EXPORTERS: unknown exporter %q, use otlp or stdout", exporter))
+		}
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("TRACING_SAMPLE_RATIO must be between 0 and 1"))
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: unknown level %q, use debug, info, warn or error", c.Log.Level))
+	}
+
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT: unknown format %q, use json or text", c.Log.Format))
+	}
+
+	errs = append(errs, c.validateRateLimit()...)
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		// browsers refuse credentials for a wildcard origin
+		if origin == "*" && c.CORS.AllowCredentials {
+			errs = append(errs, errors.New("CORS_ALLOWED_ORIGINS must list the origins when CORS_ALLOW_CREDENTIALS is set"))
+		}
+	}
+
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, errors.New("CORS_MAX_AGE must not be negative"))
+	}
+
+	if c.Idempotency.TTL <= 0 {
+		errs = append(errs, errors.New("IDEMPOTENCY_TTL must be positive"))
+	}
+
+	for _, encoding := range c.Compression.Encodings {
+		if encoding != "br" && encoding != "gzip" {
+			errs = append(errs, fmt.Errorf("COMPRESSION_ENCODINGS: unknown encoding %q, use br or gzip", encoding))
+		}
+	}
+
+	if c.Compression.MinSize < 0 {
+		errs = append(errs, errors.New("COMPRESSION_MIN_SIZE must not be negative"))
+	}
+
+	if c.Security.HSTSMaxAge < 0 {
+		errs = append(errs, errors.New("SECURITY_HSTS_MAX_AGE must not be negative"))
+	}
+
+	if c.Security.FrameOptions != "DENY" && c.Security.FrameOptions != "SAMEORIGIN" {
+		errs = append(errs, fmt.Errorf("SECURITY_FRAME_OPTIONS: unknown value %q, use DENY or SAMEORIGIN", c.Security.FrameOptions))
+	}
+
+	for _, provider := range c.OIDC {
+		prefix := "OIDC_" + strings.ToUpper(provider.Name) + "_"
+
+		if provider.DiscoveryURL == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			errs = append(errs, fmt.Errorf("%sDISCOVERY_URL, %sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix, prefix))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c Config) validateDatabase() []error {
+	errs := []error{}
+
+	_, err := database.DialectByName(c.Database.Driver)
+	if err != nil {
+		return append(errs, fmt.Errorf("DB_DRIVER: %w", err))
+	}
+
+	if c.Database.DSN == "" && c.Database.Name == "" {
+		errs = append(errs, errors.New("DATABASE_NAME is required when DB_DSN is not set"))
+	}
+
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative"))
+	}
+
+	return errs
+}
+
+func (c Config) validateRateLimit() []error {
+	errs := []error{}
+
+	switch c.RateLimit.Store {
+	case "memory":
+	case "redis":
+		if c.RateLimit.RedisURL == "" {
+			errs = append(errs, errors.New("RATE_LIMIT_REDIS_URL is required when RATE_LIMIT_STORE is redis"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE: unknown store %q, use memory or redis", c.RateLimit.Store))
+	}
+
+	return errs
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func lookupFrom(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+
+	configFile := writeFile(t, dir, "config.yaml", `
+server:
+  port: 8000
+database:
+  driver: postgres
+  query_timeout: 3s
+  name: from_yaml
+  host: yaml-host
+  max_open_conns: 20
+auth:
+  secret_key: yaml-secret
+`)
+
+	envFile := writeFile(t, dir, ".env", "DATABASE_NAME=from_dotenv\nDATABASE_HOST=dotenv-host\nSECRET_KEY=\n")
+
+	cfg, err := load(envFile, lookupFrom(map[string]string{
+		"CONFIG_FILE":   configFile,
+		"DATABASE_NAME": "from_env",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if cfg.Database.Name != "from_env" {
+		t.Errorf("environment should win over .env, got %q", cfg.Database.Name)
+	}
+
+	if cfg.Database.Host != "dotenv-host" {
+		t.Errorf(".env should win over yaml, got %q", cfg.Database.Host)
+	}
+
+	if cfg.Auth.SecretKey != "yaml-secret" {
+		t.Errorf("empty .env values should not blank yaml values, got %q", cfg.Auth.SecretKey)
+	}
+
+	if cfg.Server.Port != 8000 || cfg.Database.QueryTimeout != 3*time.Second || cfg.Database.MaxOpenConns != 20 {
+		t.Errorf("yaml values not applied: %+v", cfg)
+	}
+
+	if cfg.Database.MaxIdleConns != 10 || cfg.Database.ConnMaxLifetime != time.Hour {
+		t.Errorf("defaults not kept: %+v", cfg.Database)
+	}
+}
+
+func TestLoadWithoutFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := load(filepath.Join(dir, ".env"), lookupFrom(map[string]string{
+		"CONFIG_FILE":        "",
+		"SECRET_KEY":         "secret",
+		"DATABASE_NAME":      "chi",
+		"SERVER_PORT":        "9100",
+		"DB_QUERY_TIMEOUT":   "2s",
+		"DB_AUTO_MIGRATE":    "true",
+
+		"SERVER_TRUSTED_PROXIES": "10.1.2.3/8, 192.168.1.5",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if cfg.Server.Addr() != ":9100" || cfg.Database.QueryTimeout != 2*time.Second || !cfg.Database.AutoMigrate {
+		t.Fatalf("environment not applied: %+v", cfg)
+	}
+
+	proxies := cfg.Server.TrustedProxyPrefixes()
+	if len(proxies) != 2 || proxies[0].String() != "10.0.0.0/8" || proxies[1].String() != "192.168.1.5/32" {
+		t.Fatalf("unexpected trusted proxies: %v", proxies)
+	}
+
+	_, err = load(filepath.Join(dir, ".env"), lookupFrom(map[string]string{
+		"CONFIG_FILE": filepath.Join(dir, "missing.yaml"),
+	}))
+	if err == nil {
+		t.Fatal("a missing CONFIG_FILE should be an error")
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	_, err := load(filepath.Join(t.TempDir(), ".env"), lookupFrom(map[string]string{
+		"SERVER_PORT":            "70000",
+		"SERVER_TRUSTED_PROXIES": "proxy.internal",
+		"OIDC_PROVIDERS":         "google",
+	}))
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+
+	for _, want := range []string{"SERVER_PORT", "SERVER_TRUSTED_PROXIES", "SECRET_KEY", "DATABASE_NAME", "OIDC_GOOGLE_CLIENT_ID"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+
+	_, err = load(filepath.Join(t.TempDir(), ".env"), lookupFrom(map[string]string{
+		"SERVER_PORT": "http",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "SERVER_PORT") {
+		t.Fatalf("got %v, want a SERVER_PORT parse error", err)
+	}
+}
+
+func TestLoadOIDCProviders(t *testing.T) {
+	dir := t.TempDir()
+
+	configFile := writeFile(t, dir, "config.yaml", `
+oidc:
+  - name: google
+    discovery_url: https://accounts.google.com/.well-known/openid-configuration
+    client_id: yaml-client
+    redirect_url: https://example.com/callback
+`)
+
+	cfg, err := load(filepath.Join(dir, ".env"), lookupFrom(map[string]string{
+		"CONFIG_FILE":                 configFile,
+		"SECRET_KEY":                  "secret",
+		"DATABASE_NAME":               "chi",
+		"OIDC_PROVIDERS":              "Google, gitlab",
+		"OIDC_GOOGLE_CLIENT_ID":       "env-client",
+		"OIDC_GOOGLE_SCOPES":          "openid email",
+		"OIDC_GITLAB_DISCOVERY_URL":   "https://gitlab.com/.well-known/openid-configuration",
+		"OIDC_GITLAB_CLIENT_ID":       "gitlab-client",
+		"OIDC_GITLAB_REDIRECT_URL":    "https://example.com/gitlab",
+		"OIDC_GITLAB_CLIENT_SECRET":   "gitlab-secret",
+		"OIDC_UNLISTED_DISCOVERY_URL": "https://unlisted.example.com",
+	}))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if len(cfg.OIDC) != 2 {
+		t.Fatalf("got providers %+v", cfg.OIDC)
+	}
+
+	google := cfg.OIDC[0]
+	if google.Name != "google" || google.ClientID != "env-client" || google.RedirectURL != "https://example.com/callback" || len(google.Scopes) != 2 {
+		t.Errorf("unexpected google provider: %+v", google)
+	}
+
+	if cfg.OIDC[1].Name != "gitlab" || cfg.OIDC[1].ClientSecret != "gitlab-secret" {
+		t.Errorf("unexpected gitlab provider: %+v", cfg.OIDC[1])
+	}
+}
@@ -2,29 +2,121 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
+	"net/url"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
-var (
-	username string = os.Getenv("DATABASE_USERNAME")
-	password string = os.Getenv("DATABASE_PASSWORD")
-	database string = os.Getenv("DATABASE_NAME")
-)
+// Config is filled by the config package, pool settings left at zero keep
+// the database/sql defaults. QueryTimeout bounds every single statement,
+// zero leaves them to the context of the caller.
+type Config struct {
+	Driver          string        `yaml:"driver" env:"DB_DRIVER"`
+	DSN             string        `yaml:"dsn" env:"DB_DSN"`
+	Host            string        `yaml:"host" env:"DATABASE_HOST"`
+	Port            string        `yaml:"port" env:"DATABASE_PORT"`
+	Username        string        `yaml:"username" env:"DATABASE_USERNAME"`
+	Password        string        `yaml:"password" env:"DATABASE_PASSWORD"`
+	Name            string        `yaml:"name" env:"DATABASE_NAME"`
+	SSLMode         string        `yaml:"sslmode" env:"DATABASE_SSLMODE"`
+	AutoMigrate     bool          `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	QueryTimeout    time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+}
+
+// DataSourceName returns DSN when it is set and otherwise builds one for
+// the configured driver from the individual settings.
+func (c Config) DataSourceName() (string, error) {
+	if c.DSN != "" {
+		return c.DSN, nil
+	}
+
+	switch c.Driver {
+	case MySQL.Name:
+		// without a host the driver falls back to the local socket
+		address := ""
+		if c.Host != "" {
+			port := c.Port
+			if port == "" {
+				port = "3306"
+			}
+
+			address = fmt.Sprintf("tcp(%s:%s)", c.Host, port)
+		}
+
+		return fmt.Sprintf("%v:%v@%v/%v?parseTime=true", c.Username, c.Password, address, c.Name), nil
+
+	case Postgres.Name:
+		host := c.Host
+		if host == "" {
+			host = "localhost"
+		}
+
+		port := c.Port
+		if port == "" {
+			port = "5432"
+		}
+
+		sslMode := c.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.Username, c.Password),
+			Host:     fmt.Sprintf("%s:%s", host, port),
+			Path:     c.Name,
+			RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
+		}
+
+		return dsn.String(), nil
+
+	case SQLite.Name:
+		if c.Name == "" {
+			return "", errors.New("DATABASE_NAME must be the sqlite file path")
+		}
+
+		return fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", c.Name), nil
+	}
 
-func GetConnection() (*sql.DB, error) {
-	db, err := sql.Open("mysql", fmt.Sprintf("%v:%v@/%v?parseTime=true", username, password, database))
+	return "", fmt.Errorf("unsupported database driver %q", c.Driver)
+}
+
+func GetConnection(config Config) (*DB, error) {
+	dialect, err := DialectByName(config.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err := config.DataSourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(dialect.DriverName, dsn)
 	if err != nil {
 		return nil, err
 	}
 
-	db.SetMaxIdleConns(10)
-	db.SetMaxOpenConns(100)
-	db.SetConnMaxIdleTime(10 * time.Minute)
-	db.SetConnMaxLifetime(60 * time.Minute)
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+
+	if config.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.MaxOpenConns)
+	}
+
+	db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	db.SetConnMaxLifetime(config.ConnMaxLifetime)
 
-	return db, nil
+	return &DB{DB: db, Dialect: dialect, QueryTimeout: config.QueryTimeout}, nil
 }
@@ -0,0 +1,39 @@
+// Package databasetest provides throwaway databases for repository tests.
+package databasetest
+
+import (
+	"chi-app/database"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// NewSQLite returns a migrated SQLite database in a temporary directory
+// that is removed when the test finishes.
+func NewSQLite(t testing.TB) *database.DB {
+	t.Helper()
+
+	db, err := database.GetConnection(database.Config{
+		Driver: database.SQLite.Name,
+		Name:   filepath.Join(t.TempDir(), "test.db"),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+
+	_, err = migrator.Up(context.Background())
+	if err != nil {
+		t.Fatalf("run migrations: %v", err)
+	}
+
+	return db
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+type Dialect struct {
+	Name        string
+	DriverName  string
+	Placeholder sq.PlaceholderFormat
+}
+
+var (
+	MySQL    = Dialect{Name: "mysql", DriverName: "mysql", Placeholder: sq.Question}
+	Postgres = Dialect{Name: "postgres", DriverName: "postgres", Placeholder: sq.Dollar}
+	SQLite   = Dialect{Name: "sqlite", DriverName: "sqlite", Placeholder: sq.Question}
+)
+
+func DialectByName(name string) (Dialect, error) {
+	switch name {
+	case MySQL.Name:
+		return MySQL, nil
+	case Postgres.Name, "postgresql":
+		return Postgres, nil
+	case SQLite.Name, "sqlite3":
+		return SQLite, nil
+	}
+
+	return Dialect{}, fmt.Errorf("unsupported database driver %q", name)
+}
+
+// DB is a connection pool together with the SQL dialect it speaks, which
+// is everything a repository needs to build and run its queries.
+type DB struct {
+	*sql.DB
+	Dialect      Dialect
+	QueryTimeout time.Duration
+}
+
+func (db *DB) Builder() sq.StatementBuilderType {
+	return sq.StatementBuilder.PlaceholderFormat(db.Dialect.Placeholder)
+}
+
+// InsertReturningID runs an insert and returns the generated id. Postgres
+// has no LastInsertId, so there the id comes back through RETURNING.
+func (db *DB) InsertReturningID(ctx context.Context, query sq.InsertBuilder) (int64, error) {
+	if db.Dialect.Name == Postgres.Name {
+		var id int64
+
+		err := query.Suffix("RETURNING id").RunWith(db.Runner(ctx)).QueryRowContext(ctx).Scan(&id)
+		if err != nil {
+			return 0, err
+		}
+
+		return id, nil
+	}
+
+	result, err := query.RunWith(db.Runner(ctx)).ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.LastInsertId()
+}
@@ -0,0 +1,50 @@
+package database_test
+
+import (
+	"chi-app/database"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	ctx := context.Background()
+	_, db := newTxManager(t)
+
+	err := insertToken(ctx, db, "token")
+	if err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	sqliteErr := insertToken(ctx, db, "token")
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{sqliteErr, true},
+		{fmt.Errorf("save: %w", sqliteErr), true},
+		{&mysql.MySQLError{Number: 1062}, true},
+		{&pq.Error{Code: "23505"}, true},
+		{&mysql.MySQLError{Number: 1213}, false},
+		{&pq.Error{Code: "23503"}, false},
+		{errors.New("UNIQUE constraint failed"), false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if got := database.IsUniqueViolation(test.err); got != test.want {
+			t.Errorf("IsUniqueViolation(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+
+	// a foreign key is not a unique index
+	_, err = db.ExecContext(ctx, "INSERT INTO user_identities (user_id, provider, subject, email, created_at) VALUES (42, 'google', '1', 'a@example.com', CURRENT_TIMESTAMP)")
+	if err == nil || database.IsUniqueViolation(err) {
+		t.Fatalf("foreign key violation: got %v", err)
+	}
+}
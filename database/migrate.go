@@ -0,0 +1,392 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// MigrationsDir is where `migrate create` writes new files, relative to
+// the repository root. They are compiled into the binary from there, one
+// directory per dialect.
+const MigrationsDir = "database/migrations"
+
+var dialects = []Dialect{MySQL, Postgres, SQLite}
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	DB         *DB
+	migrations []Migration
+}
+
+func NewMigrator(DB *DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, path.Join("migrations", DB.Dialect.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{DB: DB, migrations: migrations}, nil
+}
+
+func loadMigrations(files fs.FS, root string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, root)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+
+		content, err := fs.ReadFile(files, path.Join(root, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d needs both an up and a down file", migration.Version)
+		}
+
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	timestampType := "DATETIME"
+	if m.DB.Dialect.Name == Postgres.Name {
+		timestampType = "TIMESTAMP"
+	}
+
+	_, err := m.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		applied_at %s NOT NULL,
+		PRIMARY KEY (version)
+	)`, timestampType))
+
+	return err
+}
+
+// tableExists reports whether schema_migrations has been created. The
+// read only paths ask first instead of creating it, DDL takes a metadata
+// lock and commits implicitly on MySQL, readiness probes run it every few
+// seconds.
+func (m *Migrator) tableExists(ctx context.Context) (bool, error) {
+	query := m.DB.Builder().Select("COUNT(*)").
+		From("information_schema.tables").
+		Where(sq.Eq{"table_name": "schema_migrations"})
+
+	switch m.DB.Dialect.Name {
+	case SQLite.Name:
+		query = m.DB.Builder().Select("COUNT(*)").
+			From("sqlite_master").
+			Where(sq.Eq{"type": "table", "name": "schema_migrations"})
+	case Postgres.Name:
+		query = query.Where("table_schema = current_schema()")
+	default:
+		query = query.Where("table_schema = DATABASE()")
+	}
+
+	var count int
+
+	err := query.RunWith(m.DB).QueryRowContext(ctx).Scan(&count)
+	return count > 0, err
+}
+
+// applied returns when each applied migration was applied. Without a
+// schema_migrations table nothing has been applied yet.
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	applied := map[int64]time.Time{}
+
+	exists, err := m.tableExists(ctx)
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := m.DB.Builder().Select("version", "applied_at").
+		From("schema_migrations").
+		RunWith(m.DB).
+		QueryContext(ctx)
+	if err != nil {
+		return applied, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+
+		err := rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return applied, err
+		}
+
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	statuses := []MigrationStatus{}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return statuses, err
+	}
+
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Pending returns the migrations that still have to be applied, oldest
+// first.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	pending := []Migration{}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return pending, err
+	}
+
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	done := []Migration{}
+
+	err := m.ensureTable(ctx)
+	if err != nil {
+		return done, err
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return done, err
+	}
+
+	for _, migration := range pending {
+		err := m.run(ctx, migration, migration.Up, func(tx *sql.Tx) error {
+			_, err := m.DB.Builder().Insert("schema_migrations").
+				Columns("version", "name", "applied_at").
+				Values(migration.Version, migration.Name, time.Now().UTC()).
+				RunWith(tx).
+				ExecContext(ctx)
+
+			return err
+		})
+
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down rolls back the given number of most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	done := []Migration{}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return done, err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := m.run(ctx, migration, migration.Down, func(tx *sql.Tx) error {
+			_, err := m.DB.Builder().Delete("schema_migrations").
+				Where(sq.Eq{"version": migration.Version}).
+				RunWith(tx).
+				ExecContext(ctx)
+
+			return err
+		})
+
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// run executes the statements of one migration file together with the
+// bookkeeping. Note that MySQL commits DDL implicitly, so a failing
+// statement can leave earlier statements of the same file applied.
+func (m *Migrator) run(ctx context.Context, migration Migration, script string, record func(tx *sql.Tx) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range splitStatements(script) {
+		_, err := tx.ExecContext(ctx, statement)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	err = record(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a script on semicolons that end a line, and
+// drops comment lines, so drivers without multi statement support can
+// run it one statement at a time.
+func splitStatements(script string) []string {
+	statements := []string{}
+	current := []string{}
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current = append(current, line)
+
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";")
+			statements = append(statements, statement)
+			current = []string{}
+		}
+	}
+
+	if len(current) > 0 {
+		statements = append(statements, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+
+	return statements
+}
+
+// CreateMigration writes an empty up/down pair for every dialect, numbered
+// after the newest migration in dir, and returns the paths of the files.
+func CreateMigration(dir string, name string) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(name) {
+		return nil, errors.New("migration name may only contain letters, digits and underscores")
+	}
+
+	version := int64(1)
+	for _, dialect := range dialects {
+		migrations, err := loadMigrations(os.DirFS(filepath.Join(dir, dialect.Name)), ".")
+		if err != nil {
+			return nil, err
+		}
+
+		if len(migrations) > 0 && migrations[len(migrations)-1].Version >= version {
+			version = migrations[len(migrations)-1].Version + 1
+		}
+	}
+
+	paths := []string{}
+	for _, dialect := range dialects {
+		upPath := filepath.Join(dir, dialect.Name, fmt.Sprintf("%04d_%s.up.sql", version, name))
+		downPath := filepath.Join(dir, dialect.Name, fmt.Sprintf("%04d_%s.down.sql", version, name))
+
+		err := os.WriteFile(upPath, []byte(fmt.Sprintf("-- write the forward migration for %s here\n", dialect.Name)), 0644)
+		if err != nil {
+			return paths, err
+		}
+
+		err = os.WriteFile(downPath, []byte("-- write the rollback for the up migration here\n"), 0644)
+		if err != nil {
+			return paths, err
+		}
+
+		paths = append(paths, upPath, downPath)
+	}
+
+	return paths, nil
+}
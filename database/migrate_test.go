@@ -0,0 +1,61 @@
+package database_test
+
+import (
+	"chi-app/database"
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestPendingDoesNotCreateTable(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := database.GetConnection(database.Config{
+		Driver: database.SQLite.Name,
+		Name:   filepath.Join(t.TempDir(), "empty.db"),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil || len(pending) == 0 || len(pending) != len(statuses) {
+		t.Fatalf("pending on an empty database: got %d of %d (%v), want all", len(pending), len(statuses), err)
+	}
+
+	tables := func() int {
+		var count int
+		err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'").Scan(&count)
+		if err != nil {
+			t.Fatalf("count tables: %v", err)
+		}
+
+		return count
+	}
+
+	if tables() != 0 {
+		t.Fatal("reading the status created schema_migrations")
+	}
+
+	done, err := migrator.Up(ctx)
+	if err != nil || len(done) != len(pending) || tables() != 1 {
+		t.Fatalf("up: applied %d of %d (%v)", len(done), len(pending), err)
+	}
+
+	pending, err = migrator.Pending(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Fatalf("pending after up: got %d (%v), want none", len(pending), err)
+	}
+}
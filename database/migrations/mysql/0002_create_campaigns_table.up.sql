@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS campaigns (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    short_description VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    perks TEXT NOT NULL,
+    backer_count INT NOT NULL DEFAULT 0,
+    goal_amount INT NOT NULL DEFAULT 0,
+    current_amount INT NOT NULL DEFAULT 0,
+    slug VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    KEY campaigns_user_id_index (user_id),
+    CONSTRAINT campaigns_user_id_foreign FOREIGN KEY (user_id) REFERENCES users (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
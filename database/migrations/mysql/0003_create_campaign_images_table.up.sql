@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS campaign_images (
+    id INT NOT NULL AUTO_INCREMENT,
+    campaign_id INT NOT NULL,
+    file_name VARCHAR(255) NOT NULL,
+    is_primary TINYINT(1) NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    KEY campaign_images_campaign_id_index (campaign_id),
+    CONSTRAINT campaign_images_campaign_id_foreign FOREIGN KEY (campaign_id) REFERENCES campaigns (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN bio TEXT NULL AFTER avatar_file_name,
+    ADD COLUMN totp_secret VARCHAR(64) NOT NULL DEFAULT '' AFTER role,
+    ADD COLUMN totp_enabled TINYINT(1) NOT NULL DEFAULT 0 AFTER totp_secret;
+
+UPDATE users SET bio = '' WHERE bio IS NULL;
+
+ALTER TABLE users MODIFY COLUMN bio TEXT NOT NULL;
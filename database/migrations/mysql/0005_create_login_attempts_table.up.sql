@@ -0,0 +1,7 @@
+CREATE TABLE login_attempts (
+    attempt_key VARCHAR(255) NOT NULL,
+    failed_count INT NOT NULL DEFAULT 0,
+    last_failed_at DATETIME NOT NULL,
+    locked_until DATETIME NOT NULL,
+    PRIMARY KEY (attempt_key)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+CREATE TABLE user_identities (
+    id INT NOT NULL AUTO_INCREMENT,
+    user_id INT NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY user_identities_provider_subject_unique (provider, subject),
+    KEY user_identities_user_id_index (user_id),
+    CONSTRAINT user_identities_user_id_foreign FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
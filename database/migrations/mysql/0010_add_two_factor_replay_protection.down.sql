@@ -0,0 +1,4 @@
+DROP TABLE used_challenge_tokens;
+
+ALTER TABLE users
+    DROP COLUMN totp_last_step;
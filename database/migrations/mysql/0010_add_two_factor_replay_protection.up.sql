@@ -0,0 +1,9 @@
+ALTER TABLE users
+    ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0 AFTER totp_enabled;
+
+CREATE TABLE used_challenge_tokens (
+    token_id VARCHAR(64) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (token_id),
+    KEY used_challenge_tokens_expires_at_index (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
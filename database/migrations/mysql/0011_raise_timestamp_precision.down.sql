@@ -0,0 +1,8 @@
+ALTER TABLE campaign_images
+    MODIFY updated_at DATETIME NOT NULL;
+
+ALTER TABLE campaigns
+    MODIFY updated_at DATETIME NOT NULL;
+
+ALTER TABLE users
+    MODIFY updated_at DATETIME NOT NULL;
@@ -0,0 +1,10 @@
+-- campaign ETags and the If-Match guard compare updated_at, whole seconds
+-- let two updates within one second share a version
+ALTER TABLE users
+    MODIFY updated_at DATETIME(6) NOT NULL;
+
+ALTER TABLE campaigns
+    MODIFY updated_at DATETIME(6) NOT NULL;
+
+ALTER TABLE campaign_images
+    MODIFY updated_at DATETIME(6) NOT NULL;
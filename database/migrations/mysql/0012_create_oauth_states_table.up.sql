@@ -0,0 +1,9 @@
+CREATE TABLE oauth_states (
+    state VARCHAR(64) NOT NULL,
+    provider VARCHAR(255) NOT NULL,
+    code_verifier VARCHAR(255) NOT NULL,
+    nonce VARCHAR(255) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    PRIMARY KEY (state),
+    KEY oauth_states_expires_at_index (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotency_keys
+    ADD COLUMN headers TEXT NULL AFTER content_type;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN totp_secret VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
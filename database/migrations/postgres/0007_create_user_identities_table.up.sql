@@ -0,0 +1,11 @@
+CREATE TABLE user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    CONSTRAINT user_identities_provider_subject_unique UNIQUE (provider, subject)
+);
+
+CREATE INDEX user_identities_user_id_index ON user_identities (user_id);
@@ -0,0 +1,9 @@
+CREATE TABLE oauth_states (
+    state VARCHAR(64) PRIMARY KEY,
+    provider VARCHAR(255) NOT NULL,
+    code_verifier VARCHAR(255) NOT NULL,
+    nonce VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX oauth_states_expires_at_index ON oauth_states (expires_at);
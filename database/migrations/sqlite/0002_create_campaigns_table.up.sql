@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS campaigns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id),
+    name VARCHAR(255) NOT NULL,
+    short_description VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    perks TEXT NOT NULL,
+    backer_count INTEGER NOT NULL DEFAULT 0,
+    goal_amount INTEGER NOT NULL DEFAULT 0,
+    current_amount INTEGER NOT NULL DEFAULT 0,
+    slug VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS campaigns_user_id_index ON campaigns (user_id);
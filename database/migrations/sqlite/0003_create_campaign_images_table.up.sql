@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS campaign_images (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    campaign_id INTEGER NOT NULL REFERENCES campaigns (id) ON DELETE CASCADE,
+    file_name VARCHAR(255) NOT NULL,
+    is_primary INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS campaign_images_campaign_id_index ON campaign_images (campaign_id);
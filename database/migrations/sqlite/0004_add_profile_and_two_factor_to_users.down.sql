@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN totp_enabled;
+
+ALTER TABLE users DROP COLUMN totp_secret;
+
+ALTER TABLE users DROP COLUMN bio;
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64) NOT NULL DEFAULT '';
+
+ALTER TABLE users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0;
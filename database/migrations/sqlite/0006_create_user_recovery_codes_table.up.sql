@@ -0,0 +1,9 @@
+CREATE TABLE user_recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at DATETIME NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX user_recovery_codes_user_id_index ON user_recovery_codes (user_id);
@@ -0,0 +1,3 @@
+DROP TABLE used_challenge_tokens;
+
+ALTER TABLE users DROP COLUMN totp_last_step;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE used_challenge_tokens (
+    token_id VARCHAR(64) PRIMARY KEY,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX used_challenge_tokens_expires_at_index ON used_challenge_tokens (expires_at);
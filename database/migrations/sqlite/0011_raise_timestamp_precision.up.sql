@@ -0,0 +1 @@
+-- timestamps already keep fractional seconds here, only MySQL needs this
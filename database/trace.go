@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "chi-app/database"
+
+// tracedRunner opens a client span for every statement the repositories
+// run and gives it at most timeout. Only the statement with its
+// placeholders is recorded, never the arguments, so passwords and tokens
+// stay out of the traces.
+type tracedRunner struct {
+	DBTX
+	system  string
+	timeout time.Duration
+}
+
+func (r tracedRunner) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.ExecContext(context.Background(), query, args...)
+}
+
+func (r tracedRunner) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+func (r tracedRunner) QueryRow(query string, args ...interface{}) *sql.Row {
+	return r.QueryRowContext(context.Background(), query, args...)
+}
+
+func (r tracedRunner) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	ctx, span := r.start(ctx, query)
+	defer span.End()
+
+	result, err := r.DBTX.ExecContext(ctx, query, args...)
+	err = contextError(ctx, err)
+	recordError(span, err)
+
+	return result, err
+}
+
+// QueryContext and QueryRowContext leave the timeout running, the rows are
+// read after they return and would be closed by cancelling it. The timer
+// stops at the deadline or when ctx, usually the request, is done.
+func (r tracedRunner) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, _ = r.withTimeout(ctx)
+
+	ctx, span := r.start(ctx, query)
+	defer span.End()
+
+	rows, err := r.DBTX.QueryContext(ctx, query, args...)
+	err = contextError(ctx, err)
+	recordError(span, err)
+
+	return rows, err
+}
+
+func (r tracedRunner) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, _ = r.withTimeout(ctx)
+
+	ctx, span := r.start(ctx, query)
+	defer span.End()
+
+	row := r.DBTX.QueryRowContext(ctx, query, args...)
+	recordError(span, row.Err())
+
+	return row
+}
+
+func (r tracedRunner) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// contextError adds the context error to err when the statement failed
+// because ctx ended, not every driver wraps it.
+func contextError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", err, ctx.Err())
+}
+
+func (r tracedRunner) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	operation := strings.ToUpper(strings.SplitN(strings.TrimSpace(query), " ", 2)[0])
+
+	return otel.Tracer(instrumentationName).Start(ctx, "db "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", r.system),
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", query),
+		))
+}
+
+// recordError leaves sql.ErrNoRows alone, an empty result is not a
+// failed statement.
+func recordError(span trace.Span, err error) {
+	if err == nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,52 @@
+package database_test
+
+import (
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunnerQueryTimeout(t *testing.T) {
+	ctx := context.Background()
+	db := databasetest.NewSQLite(t)
+
+	// rows are read after QueryContext returned, its timeout must not
+	// close them
+	db.QueryTimeout = time.Minute
+
+	for _, tokenID := range []string{"first", "second"} {
+		if err := insertToken(ctx, db, tokenID); err != nil {
+			t.Fatalf("insert %s: %v", tokenID, err)
+		}
+	}
+
+	rows, err := db.Runner(ctx).QueryContext(ctx, "SELECT token_id FROM used_challenge_tokens")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	count := 0
+	for rows.Next() {
+		count++
+	}
+
+	rows.Close()
+
+	if rows.Err() != nil || count != 2 {
+		t.Fatalf("read rows: got %d rows, %v", count, rows.Err())
+	}
+
+	db.QueryTimeout = time.Nanosecond
+
+	err = insertToken(ctx, db, "third")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("insert past the timeout: got %v, want context.DeadlineExceeded", err)
+	}
+
+	_, err = db.Runner(ctx).QueryContext(ctx, "SELECT token_id FROM used_challenge_tokens")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("query past the timeout: got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DBTX is the part of *sql.DB and *sql.Tx the repositories run their
+// queries on, so the same repository code works inside and outside a
+// transaction.
+type DBTX interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Transactor runs fn inside a single transaction. Repositories called
+// with the ctx handed to fn take part in it; the transaction is committed
+// when fn returns nil and rolled back otherwise.
+type Transactor interface {
+	WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txKey struct{}
+
+// Runner returns the transaction bound to ctx, or the pool when there is
+// none. Every statement run on it is traced and bounded by QueryTimeout.
+func (db *DB) Runner(ctx context.Context) DBTX {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tracedRunner{tx, db.Dialect.Name, db.QueryTimeout}
+	}
+
+	return tracedRunner{db.DB, db.Dialect.Name, db.QueryTimeout}
+}
+
+type TxManager struct {
+	DB         *DB
+	MaxRetries int
+	RetryDelay time.Duration
+}
+
+func NewTxManager(db *DB) Transactor {
+	return &TxManager{DB: db, MaxRetries: 3, RetryDelay: 50 * time.Millisecond}
+}
+
+// WithinTransaction retries the whole callback when the database picks
+// the transaction as a deadlock victim, so fn must not have side effects
+// outside the database. Nested calls join the outer transaction.
+func (m *TxManager) WithinTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := m.run(ctx, fn)
+		if err == nil || !IsDeadlock(err) || attempt >= m.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.RetryDelay * time.Duration(1<<attempt)):
+		}
+	}
+}
+
+func (m *TxManager) run(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "db transaction",
+		trace.WithAttributes(attribute.String("db.system", m.DB.Dialect.Name)))
+	defer func() {
+		recordError(span, err)
+		span.End()
+	}()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(context.WithValue(ctx, txKey{}, tx))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsDeadlock reports whether err means the transaction was rolled back
+// to break a deadlock and can safely be retried.
+func IsDeadlock(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40P01"
+	}
+
+	return false
+}
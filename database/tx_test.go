@@ -0,0 +1,137 @@
+package database_test
+
+import (
+	"chi-app/database"
+	"chi-app/database/databasetest"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+var errDeadlock = &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+
+func newTxManager(t *testing.T) (*database.TxManager, *database.DB) {
+	db := databasetest.NewSQLite(t)
+	return &database.TxManager{DB: db, MaxRetries: 2, RetryDelay: time.Millisecond}, db
+}
+
+func insertToken(ctx context.Context, db *database.DB, tokenID string) error {
+	_, err := db.Runner(ctx).ExecContext(ctx, "INSERT INTO used_challenge_tokens (token_id, expires_at) VALUES (?, ?)", tokenID, time.Now().UTC())
+	return err
+}
+
+func countTokens(t *testing.T, db *database.DB) int {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM used_challenge_tokens").Scan(&count)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+
+	return count
+}
+
+func TestWithinTransactionRetriesDeadlocks(t *testing.T) {
+	ctx := context.Background()
+	manager, db := newTxManager(t)
+
+	attempts := 0
+	err := manager.WithinTransaction(ctx, func(ctx context.Context) error {
+		attempts++
+
+		err := insertToken(ctx, db, "token")
+		if err != nil {
+			return err
+		}
+
+		if attempts < 3 {
+			return errDeadlock
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("within transaction: %v", err)
+	}
+
+	// the rows of the failed attempts were rolled back, otherwise the
+	// insert of the last attempt would have hit the primary key
+	if attempts != 3 || countTokens(t, db) != 1 {
+		t.Fatalf("got %d attempts and %d rows, want 3 and 1", attempts, countTokens(t, db))
+	}
+}
+
+func TestWithinTransactionGivesUp(t *testing.T) {
+	ctx := context.Background()
+	manager, _ := newTxManager(t)
+
+	attempts := 0
+	err := manager.WithinTransaction(ctx, func(ctx context.Context) error {
+		attempts++
+		return errDeadlock
+	})
+	if !errors.Is(err, errDeadlock) || attempts != manager.MaxRetries+1 {
+		t.Fatalf("got %v after %d attempts, want the deadlock after %d", err, attempts, manager.MaxRetries+1)
+	}
+
+	// other errors are returned straight away
+	attempts = 0
+	failure := errors.New("failure")
+	err = manager.WithinTransaction(ctx, func(ctx context.Context) error {
+		attempts++
+		return failure
+	})
+	if !errors.Is(err, failure) || attempts != 1 {
+		t.Fatalf("got %v after %d attempts, want failure after 1", err, attempts)
+	}
+}
+
+func TestWithinTransactionJoinsOuterTransaction(t *testing.T) {
+	ctx := context.Background()
+	manager, db := newTxManager(t)
+
+	failure := errors.New("failure")
+	err := manager.WithinTransaction(ctx, func(ctx context.Context) error {
+		err := manager.WithinTransaction(ctx, func(ctx context.Context) error {
+			return insertToken(ctx, db, "inner")
+		})
+		if err != nil {
+			return err
+		}
+
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("within transaction: got %v, want failure", err)
+	}
+
+	// the inner call did not commit on its own
+	if count := countTokens(t, db); count != 0 {
+		t.Fatalf("inner insert survived the outer rollback, %d rows", count)
+	}
+}
+
+func TestIsDeadlock(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errDeadlock, true},
+		{fmt.Errorf("save user: %w", errDeadlock), true},
+		{&pq.Error{Code: "40P01"}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{&pq.Error{Code: "23505"}, false},
+		{errors.New("deadlock"), false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if got := database.IsDeadlock(test.err); got != test.want {
+			t.Errorf("IsDeadlock(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
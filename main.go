@@ -1,57 +1,163 @@
 package main
 
 import (
+	"chi-app/app/apikey"
 	"chi-app/app/auth"
 	"chi-app/app/campaign"
 	"chi-app/app/handler"
-	"chi-app/app/helper"
-	"chi-app/app/key"
+	"chi-app/app/health"
+	"chi-app/app/i18n"
+	"chi-app/app/idempotency"
+	"chi-app/app/logging"
+	"chi-app/app/metrics"
+	"chi-app/app/middleware"
+	"chi-app/app/oidc"
+	"chi-app/app/ratelimit"
+	"chi-app/app/tracing"
 	"chi-app/app/user"
+	"chi-app/config"
 	"chi-app/database"
+	"chi-app/server"
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"strings"
+	"os"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 )
 
-func init() {
-	// https://github.com/joho/godotenv
-	err := godotenv.Load()
+func main() {
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal(err.Error())
+		fatal("load config", err)
 	}
-}
 
-func main() {
-	db, err := database.GetConnection()
+	slog.SetDefault(logging.New(cfg.Log, os.Stdout))
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(cfg, os.Args[2:])
+		if err != nil {
+			fatal("migrate", err)
+		}
+
+		return
+	}
+
+	db, err := database.GetConnection(cfg.Database)
 	if err != nil {
-		log.Fatal(err)
+		fatal("connect database", err)
 	}
 
 	defer db.Close()
-	fmt.Println("MySQL Connected!")
+	slog.Info("database connected", slog.String("driver", db.Dialect.Name))
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		fatal("load migrations", err)
+	}
+
+	if cfg.Database.AutoMigrate {
+		migrations, err := migrator.Up(context.Background())
+		if err != nil {
+			fatal("apply migrations", err)
+		}
+
+		slog.Info("migrations applied", slog.Int("count", len(migrations)))
+	}
+
+	// uploads are written to images/ in the working directory
+	checker := health.NewChecker()
+	checker.Add("database", health.DatabaseCheck(db))
+	checker.Add("storage", health.StorageCheck("images"))
+	checker.Add("migrations", health.MigrationsCheck(migrator))
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("set up tracing", err)
+	}
+
+	// flush the spans that are still buffered after the server is done
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := shutdownTracing(ctx)
+		if err != nil {
+			slog.Error("flush traces", slog.Any("error", err))
+		}
+	}()
+
+	appMetrics := metrics.New()
+	appMetrics.RegisterDB("main", db.DB)
 
 	// repository
 	userRepository := user.NewUserRepository(db)
 	campaignRepository := campaign.NewCampaignRepository(db)
+	apiKeyRepository := apikey.NewAPIKeyRepository(db)
+	idempotencyRepository := idempotency.NewIdempotencyRepository(db)
 
 	// service
-	userService := user.NewUserService(userRepository)
-	authService := auth.NewJwtService()
-	campaignService := campaign.NewCampaignService(campaignRepository)
+	txManager := database.NewTxManager(db)
+
+	securityPolicy := user.DefaultSecurityPolicy()
+	if cfg.Auth.BcryptCost > 0 {
+		securityPolicy.BcryptCost = cfg.Auth.BcryptCost
+	}
+
+	if cfg.Auth.LoginAttemptWindow > 0 {
+		securityPolicy.AttemptWindow = cfg.Auth.LoginAttemptWindow
+	}
+
+	userService := metrics.NewUserService(user.NewUserService(userRepository, txManager, securityPolicy), appMetrics)
+	authService := auth.NewJwtService(cfg.Auth.SecretKey)
+	campaignService := metrics.NewCampaignService(campaign.NewCampaignService(campaignRepository, txManager), appMetrics)
+	apiKeyService := apikey.NewAPIKeyService(apiKeyRepository)
 
 	// handler
-	userHandler := handler.NewUserHandler(userService, authService)
+	userHandler := handler.NewUserHandler(userService, authService, campaignService)
 	campaignHandler := handler.NewCampaignHandler(campaignService)
+	oauthHandler := handler.NewOAuthHandler(oidcProviders(cfg.OIDC), oidc.NewStateStore(db), userService, authService)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+	healthHandler := handler.NewHealthHandler(checker)
+	mediaHandler := handler.NewMediaHandler("images")
+
+	// middleware
+	authMiddleware := middleware.AuthMiddleware(authService, userService, apiKeyService)
+
+	rateLimitStore, workers, err := newRateLimitStore(cfg.RateLimit)
+	if err != nil {
+		fatal("set up rate limiting", err)
+	}
+
+	idempotencyGuard := idempotency.New(idempotencyRepository, cfg.Idempotency.TTL)
+	workers = append(workers, idempotencyGuard)
+
+	authLimit, readLimit, writeLimit, clientLimit, err := rateLimits(ratelimit.NewLimiter(rateLimitStore), cfg.RateLimit)
+	if err != nil {
+		fatal("set up rate limiting", err)
+	}
 
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(middleware.RealIP(cfg.Server))
+	r.Use(appMetrics.Middleware)
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(middleware.Recoverer)
+	r.Use(middleware.SecurityHeaders(cfg.Security))
+	r.Use(middleware.CORS(cfg.CORS))
+	r.Use(middleware.Compress(cfg.Compression))
+	r.Use(i18n.Middleware)
+
+	r.Get("/healthz", healthHandler.Healthz)
+	r.Get("/readyz", healthHandler.Readyz)
+	r.Get("/version", healthHandler.Version)
+	if cfg.Metrics.Token != "" {
+		r.Handle("/metrics", appMetrics.Handler(cfg.Metrics.Token))
+	}
+	r.With(readLimit, middleware.MediaHeaders).Get("/images/*", http.StripPrefix("/images/", http.HandlerFunc(mediaHandler.ServeFile)).ServeHTTP)
 
 	// route list
 	r.Route("/api/v1", func(r chi.Router) {
@@ -60,68 +166,95 @@ func main() {
 		})
 
 		// USERS
-		r.Post("/users", userHandler.RegisterUser)
-		r.Post("/sessions", userHandler.Login)
-		r.Post("/email_checkers", userHandler.CheckEmailAvailable)
-		r.With(func(h http.Handler) http.Handler { return authMiddleware(h, authService, userService) }).Post("/avatars", userHandler.UploadAvatar)
+		r.With(authLimit).Post("/users", userHandler.RegisterUser)
+		r.With(readLimit).Get("/users/{id}", userHandler.GetProfile)
+		r.With(authLimit).Post("/sessions", userHandler.Login)
+		r.With(authLimit).Post("/sessions/2fa", userHandler.VerifyTwoFactor)
+		r.With(authLimit).Get("/oauth/{provider}/authorize", oauthHandler.Authorize)
+		r.With(authLimit).Get("/oauth/{provider}/callback", oauthHandler.Callback)
+		r.With(authLimit).Post("/email_checkers", userHandler.CheckEmailAvailable)
+		r.With(clientLimit, authMiddleware, writeLimit, idempotencyGuard.Middleware, middleware.SessionOnly).Post("/avatars", userHandler.UploadAvatar)
+		r.With(clientLimit, authMiddleware, writeLimit, middleware.SessionOnly).Post("/users/2fa/enrollment", userHandler.EnrollTwoFactor)
+		r.With(clientLimit, authMiddleware, writeLimit, middleware.SessionOnly).Post("/users/2fa/confirmation", userHandler.ConfirmTwoFactor)
+
+		// API KEYS
+		r.With(clientLimit, authMiddleware, writeLimit, middleware.SessionOnly).Post("/api_keys", apiKeyHandler.CreateAPIKey)
+		r.With(clientLimit, authMiddleware, readLimit, middleware.SessionOnly).Get("/api_keys", apiKeyHandler.GetAPIKeys)
+		r.With(clientLimit, authMiddleware, writeLimit, middleware.SessionOnly).Delete("/api_keys/{id}", apiKeyHandler.RevokeAPIKey)
+
+		// ADMIN
+		r.With(clientLimit, authMiddleware, writeLimit, middleware.SessionOnly, middleware.AdminOnly).Post("/admin/users/{id}/unlock", userHandler.UnlockUser)
 
 		// CAMPAIGNS
-		r.Get("/campaigns/{id}", campaignHandler.GetCampaignDetail)
-		r.Get("/campaigns", campaignHandler.GetCampaigns)
-		r.With(func(h http.Handler) http.Handler { return authMiddleware(h, authService, userService) }).Post("/campaigns", campaignHandler.CreateCampaign)
-		r.With(func(h http.Handler) http.Handler { return authMiddleware(h, authService, userService) }).Put("/campaigns/{id}", campaignHandler.UpdateCampaign)
+		r.With(readLimit).Get("/campaigns/{id}", campaignHandler.GetCampaignDetail)
+		r.With(readLimit).Get("/campaigns", campaignHandler.GetCampaigns)
+		r.With(clientLimit, authMiddleware, writeLimit, idempotencyGuard.Middleware, middleware.RequireScope(apikey.ScopeCampaignsWrite)).Post("/campaigns", campaignHandler.CreateCampaign)
+		r.With(clientLimit, authMiddleware, writeLimit, idempotencyGuard.Middleware, middleware.RequireScope(apikey.ScopeCampaignsWrite)).Put("/campaigns/{id}", campaignHandler.UpdateCampaign)
+		r.With(clientLimit, authMiddleware, writeLimit, idempotencyGuard.Middleware, middleware.RequireScope(apikey.ScopeCampaignsWrite)).Post("/campaign-images", campaignHandler.UploadCampaignImage)
 	})
 
-	// listen in port 9000
-	err = http.ListenAndServe(":9000", r)
+	ctx, stop := server.SignalContext(context.Background())
+	defer stop()
+
+	context.AfterFunc(ctx, checker.Drain)
+
+	// the deferred db.Close runs once the requests are drained
+	err = server.Run(ctx, server.New(cfg.Server, r), cfg.Server, workers...)
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("server stopped", slog.Any("error", err))
 	}
 }
 
-func authMiddleware(h http.Handler, authService auth.Service, userService user.Service) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("authorization")
-
-		if !strings.Contains(authHeader, "Bearer") {
-			response := helper.APIResponse("Unauthorized", http.StatusUnauthorized, "error", nil)
-			helper.JSON(w, response, http.StatusUnauthorized)
-			return
+// newRateLimitStore returns the store with the workers it needs, the
+// memory store sweeps its idle buckets in the background.
+func newRateLimitStore(cfg config.RateLimit) (ratelimit.Store, []server.Worker, error) {
+	if cfg.Store == "redis" {
+		options, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("RATE_LIMIT_REDIS_URL: %w", err)
 		}
 
-		tokenString := ""
-		arrayToken := strings.Split(authHeader, " ")
-		if len(arrayToken) == 2 {
-			tokenString = arrayToken[1]
-		}
+		return ratelimit.NewRedisStore(redis.NewClient(options), "ratelimit:"), nil, nil
+	}
 
-		token, err := authService.ValidateToken(tokenString)
-		if err != nil {
-			response := helper.APIResponse("Unauthorized", http.StatusUnauthorized, "error", nil)
-			helper.JSON(w, response, http.StatusUnauthorized)
-			return
-		}
+	store := ratelimit.NewMemoryStore()
+	return store, []server.Worker{store}, nil
+}
 
-		claim, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			response := helper.APIResponse("Unauthorized", http.StatusUnauthorized, "error", nil)
-			helper.JSON(w, response, http.StatusUnauthorized)
-			return
-		}
+func rateLimits(limiter *ratelimit.Limiter, cfg config.RateLimit) (auth, read, write, client func(http.Handler) http.Handler, err error) {
+	authLimit, err := ratelimit.ParseLimit(cfg.Auth)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("RATE_LIMIT_AUTH: %w", err)
+	}
 
-		userID := int(claim["user_id"].(float64))
+	readLimit, err := ratelimit.ParseLimit(cfg.Read)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("RATE_LIMIT_READ: %w", err)
+	}
 
-		user, err := userService.GetUserByID(userID)
-		if err != nil {
-			response := helper.APIResponse("Unauthorized", http.StatusUnauthorized, "error", nil)
-			helper.JSON(w, response, http.StatusUnauthorized)
-			return
-		}
+	writeLimit, err := ratelimit.ParseLimit(cfg.Write)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("RATE_LIMIT_WRITE: %w", err)
+	}
 
-		ctx := r.Context()
-		ctxAuth := context.WithValue(ctx, key.CtxKeyAuth{}, user)
+	clientLimit, err := ratelimit.ParseLimit(cfg.Client)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("RATE_LIMIT_CLIENT: %w", err)
+	}
 
-		// next to route
-		h.ServeHTTP(w, r.WithContext(ctxAuth))
-	})
+	return limiter.Middleware("auth", authLimit), limiter.Middleware("read", readLimit), limiter.Middleware("write", writeLimit), limiter.Middleware("client", clientLimit), nil
+}
+
+func fatal(message string, err error) {
+	slog.Error(message, slog.Any("error", err))
+	os.Exit(1)
+}
+
+func oidcProviders(configs []oidc.Config) []*oidc.Provider {
+	providers := []*oidc.Provider{}
+	for _, config := range configs {
+		providers = append(providers, oidc.NewProvider(config, nil))
+	}
+
+	return providers
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"chi-app/config"
+	"chi-app/database"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status | create <name>"
+
+// runMigrate implements the `migrate` subcommand of the server binary.
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			return errors.New("usage: migrate create <name>")
+		}
+
+		paths, err := database.CreateMigration(database.MigrationsDir, args[1])
+		for _, path := range paths {
+			fmt.Printf("created %s\n", path)
+		}
+
+		return err
+	}
+
+	db, err := database.GetConnection(cfg.Database)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		migrations, err := migrator.Up(ctx)
+		for _, migration := range migrations {
+			fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		if err == nil && len(migrations) == 0 {
+			fmt.Println("database is up to date")
+		}
+
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return errors.New("steps must be a positive number")
+			}
+		}
+
+		migrations, err := migrator.Down(ctx, steps)
+		for _, migration := range migrations {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+
+		return err
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+
+			fmt.Printf("%04d_%-45s %s\n", status.Version, status.Name, appliedAt)
+		}
+
+		return nil
+	}
+
+	return errors.New(migrateUsage)
+}
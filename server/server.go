@@ -0,0 +1,117 @@
+// Package server runs the HTTP server until its context is done, usually
+// by SIGINT or SIGTERM through SignalContext, and then shuts it down:
+// in-flight requests are drained first, background workers are stopped
+// after that, so the caller can close the database last.
+package server
+
+import (
+	"chi-app/config"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Worker is a background job that runs until ctx is cancelled.
+type Worker interface {
+	Run(ctx context.Context)
+}
+
+type WorkerFunc func(ctx context.Context)
+
+func (f WorkerFunc) Run(ctx context.Context) {
+	f(ctx)
+}
+
+func New(cfg config.Server, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+}
+
+// SignalContext is done once the process gets SIGINT or SIGTERM.
+func SignalContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(parent, os.Interrupt, syscall.SIGTERM)
+}
+
+// Run listens on srv.Addr and serves until ctx is done.
+func Run(ctx context.Context, srv *http.Server, cfg config.Server, workers ...Worker) error {
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+
+	return Serve(ctx, srv, listener, cfg, workers...)
+}
+
+// Serve is Run on an existing listener.
+func Serve(ctx context.Context, srv *http.Server, listener net.Listener, cfg config.Server, workers ...Worker) error {
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	var wg sync.WaitGroup
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(worker Worker) {
+			defer wg.Done()
+			worker.Run(workerCtx)
+		}(worker)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLSEnabled() {
+			slog.Info("listening", slog.String("addr", listener.Addr().String()), slog.Bool("tls", true))
+			serveErr <- srv.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+			return
+		}
+
+		slog.Info("listening", slog.String("addr", listener.Addr().String()), slog.Bool("tls", false))
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		stopWorkers()
+		wg.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	// keep accepting requests for a moment, readiness probes answer 503
+	// by now and the load balancer needs time to notice
+	if cfg.ShutdownDelay > 0 {
+		slog.Info("shutting down after delay", slog.Duration("delay", cfg.ShutdownDelay))
+		time.Sleep(cfg.ShutdownDelay)
+	}
+
+	slog.Info("shutting down, draining requests", slog.Duration("timeout", cfg.ShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+
+	stopWorkers()
+	wg.Wait()
+
+	if serveErr := <-serveErr; !errors.Is(serveErr, http.ErrServerClosed) && err == nil {
+		err = serveErr
+	}
+
+	return err
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"chi-app/config"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsRequestsAndStopsWorkers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	cfg := config.Default().Server
+	srv := New(cfg, handler)
+
+	workerStopped := make(chan struct{})
+	worker := WorkerFunc(func(ctx context.Context) {
+		<-ctx.Done()
+		close(workerStopped)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, srv, listener, cfg, worker)
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		responses <- string(body)
+	}()
+
+	<-started
+	cancel()
+
+	if body := <-responses; body != "done" {
+		t.Fatalf("in-flight request was not drained: %q", body)
+	}
+
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after shutdown")
+	}
+
+	select {
+	case <-workerStopped:
+	default:
+		t.Fatal("worker still running after serve returned")
+	}
+
+	_, err = http.Get("http://" + listener.Addr().String())
+	if err == nil {
+		t.Fatal("server still accepts connections after shutdown")
+	}
+}
+
+func TestNewAppliesLimits(t *testing.T) {
+	cfg := config.Default().Server
+	srv := New(cfg, http.NotFoundHandler())
+
+	if srv.ReadHeaderTimeout != cfg.ReadHeaderTimeout || srv.WriteTimeout != cfg.WriteTimeout || srv.IdleTimeout != cfg.IdleTimeout || srv.MaxHeaderBytes != cfg.MaxHeaderBytes {
+		t.Fatalf("limits not applied: %+v", srv)
+	}
+}